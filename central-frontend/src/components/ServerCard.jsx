@@ -22,6 +22,14 @@ const AdaptiveStatusIndicators = ({ stats, cardWidth }) => {
     return parseFloat((bytes / Math.pow(k, i)).toFixed(1)) + " " + sizes[i];
   };
 
+  // Every reported mount with bytes and inodes, shown when hovering disk usage
+  const mountsTitle = (stats.disks || [])
+    .map(
+      (mount) =>
+        `${mount.mountpoint}: ${Math.round(mount.percent)}% (${formatBytes(mount.used)}), inodes ${Math.round(mount.inodes_percent)}%`,
+    )
+    .join("\n");
+
   const isCompact = cardWidth < 400;
   const isLarge = cardWidth > 500;
 
@@ -90,7 +98,10 @@ const AdaptiveStatusIndicators = ({ stats, cardWidth }) => {
           </span>
         </div>
 
-        <div style={{ display: "flex", alignItems: "center", gap: "4px" }}>
+        <div
+          style={{ display: "flex", alignItems: "center", gap: "4px" }}
+          title={mountsTitle || undefined}
+        >
           <div
             style={{
               width: "6px",
@@ -117,6 +128,31 @@ const AdaptiveStatusIndicators = ({ stats, cardWidth }) => {
             ({formatBytes(stats.disk.used)})
           </span>
         </div>
+
+        {/* Older agents don't send load, the color compares it to the core count */}
+        {stats.load && (
+          <div style={{ display: "flex", alignItems: "center", gap: "4px" }}>
+            <span
+              style={{ color: "#fff", fontWeight: "500", fontSize: "1.15rem" }}
+            >
+              LOAD:
+            </span>
+            <span
+              style={{
+                color: getStatusColor(
+                  (stats.load.load1 / (stats.cpu_cores?.length || 1)) * 100,
+                ),
+                fontWeight: "bold",
+                fontSize: "1.2rem",
+              }}
+            >
+              {stats.load.load1.toFixed(2)}
+            </span>
+            <span style={{ color: "#666", fontSize: "0.7rem" }}>
+              ({stats.load.load5.toFixed(2)} {stats.load.load15.toFixed(2)})
+            </span>
+          </div>
+        )}
       </div>
     );
   } else if (isCompact) {
@@ -540,10 +576,18 @@ export const ServerCard = ({
           <TmuxDisplay
             dataHistory={server.data_history}
             sessionName={
-              server.data_history.length > 0
-                ? server.data_history[server.data_history.length - 1]
-                    .session_name
-                : "session"
+              server.sessions?.length > 0
+                ? server.sessions
+                    .map((session) =>
+                      session.socket
+                        ? `${session.socket}:${session.name}`
+                        : session.name,
+                    )
+                    .join(", ")
+                : server.data_history.length > 0
+                  ? server.data_history[server.data_history.length - 1]
+                      .session_name
+                  : "session"
             }
           />
         </div>
@@ -26,6 +26,13 @@ export const TmuxDisplay = ({ dataHistory, sessionName }) => {
             contentHistory: [pane.content || ""],
           };
         } else {
+          // Keep metadata (command, title, size) from the newest entry
+          accumulatedPanes[paneKey] = {
+            ...accumulatedPanes[paneKey],
+            ...pane,
+            content: accumulatedPanes[paneKey].content,
+          };
+
           if (
             pane.content &&
             pane.content !==
@@ -124,6 +131,53 @@ export const TmuxDisplay = ({ dataHistory, sessionName }) => {
       window.removeEventListener("tmux-switch-window", handleWindowSwitch);
   }, [windowIds.length]);
 
+  // Reproduce the real tmux split when the agent sent pane coordinates
+  const hasGeometry =
+    currentWindowPanes.length > 1 &&
+    currentWindowPanes.every((pane) => pane.width && pane.height);
+  const layoutWidth = Math.max(
+    ...currentWindowPanes.map((pane) => (pane.left || 0) + (pane.width || 0)),
+  );
+  const layoutHeight = Math.max(
+    ...currentWindowPanes.map((pane) => (pane.top || 0) + (pane.height || 0)),
+  );
+
+  const paneStyle = (pane) => {
+    if (hasGeometry) {
+      return {
+        position: "absolute",
+        left: `${((pane.left || 0) / layoutWidth) * 100}%`,
+        top: `${((pane.top || 0) / layoutHeight) * 100}%`,
+        width: `${(pane.width / layoutWidth) * 100}%`,
+        height: `${(pane.height / layoutHeight) * 100}%`,
+      };
+    }
+    if (pane.width && pane.height) {
+      return { flexGrow: pane.width, flexBasis: 0 };
+    }
+    return undefined;
+  };
+
+  const formatBytes = (bytes) => {
+    if (!bytes) return "0 B";
+    const k = 1024;
+    const sizes = ["B", "KB", "MB", "GB", "TB"];
+    const i = Math.floor(Math.log(bytes) / Math.log(k));
+    return parseFloat((bytes / Math.pow(k, i)).toFixed(1)) + " " + sizes[i];
+  };
+
+  const formatActivity = (lastActivity) => {
+    if (!lastActivity) return "no activity seen";
+
+    const diffSecs = Math.max(
+      0,
+      Math.floor(Date.now() / 1000 - lastActivity),
+    );
+    if (diffSecs < 60) return `active ${diffSecs}s ago`;
+    if (diffSecs < 3600) return `active ${Math.floor(diffSecs / 60)}m ago`;
+    return `active ${Math.floor(diffSecs / 3600)}h ago`;
+  };
+
   const switchToWindow = (index) => {
     setSelectedWindowIndex(index);
   };
@@ -134,6 +188,8 @@ export const TmuxDisplay = ({ dataHistory, sessionName }) => {
     return (
       <div
         key={pane.id}
+        title={pane.title || undefined}
+        style={paneStyle(pane)}
         className="relative min-h-0 min-w-0 flex-1 overflow-hidden rounded-md border border-gray-600 bg-black p-2 text-sm leading-relaxed"
       >
         <div
@@ -144,12 +200,55 @@ export const TmuxDisplay = ({ dataHistory, sessionName }) => {
           }}
           className="scrollbar-thin scrollbar-track-gray-800 scrollbar-thumb-gray-600 h-full overflow-auto whitespace-pre-wrap break-words text-gray-300"
         >
-          <AnsiText>{pane.content.replace(/\n+$/, "")}</AnsiText>
+          {pane.privacy === "metadata" ? (
+            // Content of metadata only panes never leaves the agent
+            <div className="flex h-full flex-col items-center justify-center gap-1 text-gray-500">
+              <span>🔒 Content hidden</span>
+              <span className="text-xs">
+                {pane.current_command || "unknown command"}
+                {pane.width && pane.height && ` · ${pane.width}x${pane.height}`}
+                {` · ${formatActivity(pane.last_activity)}`}
+              </span>
+            </div>
+          ) : (
+            <>
+              {pane.scrollback && (
+                <div className="border-b border-dashed border-gray-700 text-gray-500">
+                  <AnsiText>{pane.scrollback.replace(/\n+$/, "")}</AnsiText>
+                </div>
+              )}
+              <AnsiText>{pane.content.replace(/\n+$/, "")}</AnsiText>
+            </>
+          )}
         </div>
 
-        <div className="pointer-events-none absolute left-1.5 top-1.5 rounded bg-purple-500/80 px-1.5 py-0.5 text-sm font-bold text-white">
+        <div
+          className={`pointer-events-none absolute left-1.5 top-1.5 rounded px-1.5 py-0.5 text-sm font-bold text-white ${
+            pane.dead ? "bg-red-500/80" : "bg-purple-500/80"
+          }`}
+          title={pane.current_path}
+        >
           {pane.id}
+          {pane.current_command && ` · ${pane.current_command}`}
+          {pane.dead && " (dead)"}
         </div>
+
+        {pane.usage && (
+          <div
+            className={`absolute right-1.5 top-1.5 rounded px-1.5 py-0.5 text-xs font-bold text-white ${
+              pane.usage.cpu_percent > 90 ? "bg-red-500/80" : "bg-zinc-700/80"
+            }`}
+            title={(pane.usage.top || [])
+              .map(
+                (child) =>
+                  `${child.pid} ${child.name}: ${Math.round(child.cpu_percent)}% CPU, ${formatBytes(child.rss)}`,
+              )
+              .join("\n")}
+          >
+            {Math.round(pane.usage.cpu_percent)}% · {formatBytes(pane.usage.rss)}
+            {pane.usage.processes > 1 && ` · ${pane.usage.processes} procs`}
+          </div>
+        )}
       </div>
     );
   };
@@ -186,8 +285,10 @@ export const TmuxDisplay = ({ dataHistory, sessionName }) => {
       </div>
 
       <div
-        className={`scrollbar-thin scrollbar-track-gray-800 scrollbar-thumb-gray-600 flex min-h-0 flex-1 gap-2 overflow-hidden p-1 ${
-          currentWindowPanes.length > 1 ? "flex-row" : "flex-col"
+        className={`scrollbar-thin scrollbar-track-gray-800 scrollbar-thumb-gray-600 min-h-0 flex-1 overflow-hidden p-1 ${
+          hasGeometry
+            ? "relative"
+            : `flex gap-2 ${currentWindowPanes.length > 1 ? "flex-row" : "flex-col"}`
         }`}
       >
         {currentWindowPanes.map((pane, index) => renderPane(pane, index))}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid agent token")
+	ErrServerNotAllowed = errors.New("token is not allowed to report as this server")
+)
+
+// AgentToken binds a token to the server names it may report as. Server
+// names may use path.Match globs such as "build-*".
+type AgentToken struct {
+	Token   string   `json:"token"`
+	Servers []string `json:"servers"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+type tokenFile struct {
+	Agents []AgentToken `json:"agents"`
+}
+
+type tokenEntry struct {
+	hash    [32]byte
+	servers []string
+}
+
+type TokenStore struct {
+	path    string
+	entries []tokenEntry
+	mutex   sync.RWMutex
+}
+
+func LoadTokenStore(filePath string) (*TokenStore, error) {
+	ts := &TokenStore{path: filePath}
+	if err := ts.Reload(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (ts *TokenStore) Reload() error {
+	data, err := os.ReadFile(ts.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+
+	var file tokenFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to unmarshal token file: %w", err)
+	}
+
+	entries := make([]tokenEntry, 0, len(file.Agents))
+	for i, agent := range file.Agents {
+		if agent.Token == "" {
+			return fmt.Errorf("agent entry %d has an empty token", i)
+		}
+		for _, pattern := range agent.Servers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("agent entry %d has invalid server pattern %q: %w", i, pattern, err)
+			}
+		}
+
+		entries = append(entries, tokenEntry{
+			hash:    sha256.Sum256([]byte(agent.Token)),
+			servers: agent.Servers,
+		})
+	}
+
+	ts.mutex.Lock()
+	ts.entries = entries
+	ts.mutex.Unlock()
+
+	return nil
+}
+
+func (ts *TokenStore) Count() int {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return len(ts.entries)
+}
+
+// Authorize checks that token exists and may report as serverName.
+func (ts *TokenStore) Authorize(token, serverName string) error {
+	hash := sha256.Sum256([]byte(token))
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	var matched *tokenEntry
+	for i := range ts.entries {
+		// NOTE: Compare against every entry so timing doesn't leak which tokens exist
+		if subtle.ConstantTimeCompare(hash[:], ts.entries[i].hash[:]) == 1 {
+			matched = &ts.entries[i]
+		}
+	}
+
+	if matched == nil {
+		return ErrInvalidToken
+	}
+
+	for _, pattern := range matched.servers {
+		if ok, _ := path.Match(pattern, serverName); ok {
+			return nil
+		}
+	}
+
+	return ErrServerNotAllowed
+}
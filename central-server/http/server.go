@@ -32,6 +32,8 @@ func (s *HTTPServer) Start() error {
 	api := r.PathPrefix("/api").Subrouter()
 	api.HandleFunc("/servers", s.handleGetServers).Methods("GET")
 	api.HandleFunc("/servers/{name}", s.handleGetServer).Methods("GET")
+	api.HandleFunc("/servers/{name}/stats", s.handleGetServerStats).Methods("GET")
+	api.HandleFunc("/servers/{name}/processes", s.handleGetServerProcesses).Methods("GET")
 	api.HandleFunc("/health", s.handleHealth).Methods("GET")
 
 	log.Printf(" HTTP API server listening on port %s", s.port)
@@ -83,6 +85,49 @@ func (s *HTTPServer) handleGetServer(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(server)
 }
 
+func (s *HTTPServer) handleGetServerStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverName := vars["name"]
+
+	server := s.serverManager.GetServer(serverName)
+	if server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	history := server.GetStatsHistory()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"server":  serverName,
+		"history": history,
+		"count":   len(history),
+	})
+}
+
+func (s *HTTPServer) handleGetServerProcesses(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	serverName := vars["name"]
+
+	server := s.serverManager.GetServer(serverName)
+	if server == nil {
+		http.Error(w, "Server not found", http.StatusNotFound)
+		return
+	}
+
+	processes := server.GetTopProcesses()
+	if processes == nil {
+		http.Error(w, "No process list received", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"server":    serverName,
+		"processes": processes,
+	})
+}
+
 func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	servers := s.serverManager.GetAllServers()
 
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"central-server/auth"
 	"central-server/http"
 	"central-server/storage"
 	"central-server/tcp"
 	"central-server/types"
 	"central-server/websocket"
+	"flag"
 	"log"
 	bhttp "net/http"
 	_ "net/http/pprof"
@@ -16,6 +18,17 @@ import (
 const version = "v0.1.1"
 
 func main() {
+	tlsCert := flag.String("tls-cert", "", "TLS certificate for the agent TCP listener")
+	tlsKey := flag.String("tls-key", "", "TLS private key for the agent TCP listener")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA used to verify agent client certificates")
+	maxFrameSize := flag.Int("max-frame-size", tcp.DefaultMaxFrameSize, "largest agent frame in bytes accepted on the TCP listener")
+	tokenFile := flag.String("tokens", "", "JSON file of agent tokens and the server names they may report as")
+	flag.Parse()
+
+	if *maxFrameSize < tcp.MinMaxFrameSize {
+		log.Fatalf("-max-frame-size must be at least %d bytes", tcp.MinMaxFrameSize)
+	}
+
 	log.Println("Starting Tmux Monitor Central Server", version)
 
 	go func() {
@@ -54,6 +67,32 @@ func main() {
 	}()
 
 	tcpServer := tcp.NewTCPServer("8080", serverManager, broadcaster)
+	tcpServer.SetServerVersion(version)
+	tcpServer.SetMaxFrameSize(*maxFrameSize)
+	if *tlsCert != "" || *tlsKey != "" {
+		tlsConfig, err := tcp.LoadTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+		tcpServer.SetTLSConfig(tlsConfig)
+		if *tlsClientCA != "" {
+			log.Println(" Agent client certificates required")
+		}
+	} else if *tlsClientCA != "" {
+		log.Fatalf("-tls-client-ca requires -tls-cert and -tls-key")
+	}
+
+	if *tokenFile != "" {
+		tokenStore, err := auth.LoadTokenStore(*tokenFile)
+		if err != nil {
+			log.Fatalf("Failed to load agent tokens: %v", err)
+		}
+		tcpServer.SetAuthenticator(tokenStore)
+		log.Printf(" Loaded %d agent tokens from %s", tokenStore.Count(), *tokenFile)
+	} else {
+		log.Println("  Agent token authentication disabled (no -tokens file)")
+	}
+
 	go func() {
 		if err := tcpServer.Start(); err != nil {
 			log.Fatalf("TCP server failed: %v", err)
@@ -18,9 +18,12 @@ type DataStorage struct {
 }
 
 type StoredServerData struct {
-	ServerName  string             `json:"server_name"`
-	LastSeen    time.Time          `json:"last_seen"`
-	DataHistory []types.ServerData `json:"data_history"`
+	ServerName   string              `json:"server_name"`
+	LastSeen     time.Time           `json:"last_seen"`
+	Delivery     types.DeliveryState `json:"delivery"`
+	PaneEvents   []types.PaneEvent   `json:"pane_events,omitempty"`
+	TopProcesses *types.TopProcesses `json:"top_processes,omitempty"`
+	DataHistory  []types.ServerData  `json:"data_history"`
 }
 
 func NewDataStorage() *DataStorage {
@@ -49,9 +52,12 @@ func (ds *DataStorage) SaveServerData(serverInfo *types.ServerInfo) error {
 
 	serverInfo.RLock()
 	storedData := StoredServerData{
-		ServerName:  serverInfo.Name,
-		LastSeen:    serverInfo.LastSeen,
-		DataHistory: make([]types.ServerData, len(serverInfo.DataHistory)),
+		ServerName:   serverInfo.Name,
+		LastSeen:     serverInfo.LastSeen,
+		Delivery:     serverInfo.Delivery,
+		PaneEvents:   append([]types.PaneEvent(nil), serverInfo.PaneEvents...),
+		TopProcesses: serverInfo.TopProcesses,
+		DataHistory:  make([]types.ServerData, len(serverInfo.DataHistory)),
 	}
 	copy(storedData.DataHistory, serverInfo.DataHistory)
 	serverInfo.RUnlock()
@@ -87,9 +93,15 @@ func (ds *DataStorage) LoadServerData(serverName string) (*types.ServerInfo, err
 	}
 
 	serverInfo := &types.ServerInfo{
-		Name:        storedData.ServerName,
-		LastSeen:    storedData.LastSeen,
-		DataHistory: storedData.DataHistory,
+		Name:         storedData.ServerName,
+		LastSeen:     storedData.LastSeen,
+		Delivery:     storedData.Delivery,
+		PaneEvents:   storedData.PaneEvents,
+		TopProcesses: storedData.TopProcesses,
+		DataHistory:  storedData.DataHistory,
+	}
+	if latest := serverInfo.GetLatestData(); latest != nil {
+		serverInfo.Sessions = types.GroupBySession(*latest)
 	}
 
 	serverInfo.UpdateStateFromLastSeen()
@@ -0,0 +1,214 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Protocol v1 sends one JSON document per line. Protocol v2 and later
+// prefix every frame with a 5 byte header: a big-endian uint32 payload
+// length followed by a flags byte.
+const frameHeaderSize = 5
+
+// Frame flags.
+const (
+	FlagGzip byte = 1 << iota
+)
+
+const (
+	DefaultMaxFrameSize = 16 * 1024 * 1024
+	// MinMaxFrameSize is the smallest frame limit allowed, below it even
+	// a sample with a few panes would be rejected.
+	MinMaxFrameSize = 64 * 1024
+	maxHelloSize    = 64 * 1024
+)
+
+type Frame struct {
+	Flags   byte
+	Payload []byte
+}
+
+// InvalidFrameError reports a single bad frame. The frame has been consumed from
+// the stream, so the connection can keep reading after replying, unless it is
+// Fatal: frames too large to be worth draining are left unread and the
+// connection has to be closed.
+type InvalidFrameError struct {
+	Size   int
+	Reason string
+	Fatal  bool
+}
+
+func (e *InvalidFrameError) Error() string {
+	return e.Reason
+}
+
+func frameTooLarge(size, limit int) *InvalidFrameError {
+	return &InvalidFrameError{
+		Size:   size,
+		Reason: fmt.Sprintf("frame of %d bytes exceeds limit of %d bytes", size, limit),
+	}
+}
+
+// drainLimit is how large an oversized frame may be and still be read past,
+// so one bad frame doesn't cost the connection but a peer can't keep the read
+// loop busy for gigabytes.
+func drainLimit(limit int) int {
+	return 2 * limit
+}
+
+type frameReader interface {
+	ReadFrame() (Frame, error)
+}
+
+type frameWriter interface {
+	WriteFrame(frame Frame) error
+}
+
+type lineFrameReader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+func (lr *lineFrameReader) ReadFrame() (Frame, error) {
+	var line []byte
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		if len(line)+len(chunk) > lr.maxSize {
+			size := len(line) + len(chunk)
+			for err == bufio.ErrBufferFull {
+				if size > drainLimit(lr.maxSize) {
+					tooLarge := frameTooLarge(size, lr.maxSize)
+					tooLarge.Fatal = true
+					return Frame{}, tooLarge
+				}
+				chunk, err = lr.r.ReadSlice('\n')
+				size += len(chunk)
+			}
+			if err != nil {
+				return Frame{}, err
+			}
+			return Frame{}, frameTooLarge(size, lr.maxSize)
+		}
+
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return Frame{}, err
+		}
+
+		return Frame{Payload: bytes.TrimRight(line, "\r\n")}, nil
+	}
+}
+
+type lineFrameWriter struct {
+	conn net.Conn
+}
+
+func (lw *lineFrameWriter) WriteFrame(frame Frame) error {
+	lw.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	defer lw.conn.SetWriteDeadline(time.Time{})
+
+	_, err := lw.conn.Write(append(frame.Payload, '\n'))
+	return err
+}
+
+type lengthFrameReader struct {
+	r       *bufio.Reader
+	maxSize int
+}
+
+func (fr *lengthFrameReader) ReadFrame() (Frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	flags := header[4]
+
+	if size > drainLimit(fr.maxSize) {
+		tooLarge := frameTooLarge(size, fr.maxSize)
+		tooLarge.Fatal = true
+		return Frame{}, tooLarge
+	}
+	if size > fr.maxSize {
+		if _, err := io.CopyN(io.Discard, fr.r, int64(size)); err != nil {
+			return Frame{}, err
+		}
+		return Frame{}, frameTooLarge(size, fr.maxSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(fr.r, payload); err != nil {
+		return Frame{}, err
+	}
+
+	return Frame{Flags: flags, Payload: payload}, nil
+}
+
+type lengthFrameWriter struct {
+	conn net.Conn
+}
+
+func (fw *lengthFrameWriter) WriteFrame(frame Frame) error {
+	buf := make([]byte, frameHeaderSize+len(frame.Payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(frame.Payload)))
+	buf[4] = frame.Flags
+	copy(buf[frameHeaderSize:], frame.Payload)
+
+	fw.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	defer fw.conn.SetWriteDeadline(time.Time{})
+
+	_, err := fw.conn.Write(buf)
+	return err
+}
+
+// decodePayload undoes any compression announced in the frame flags. The
+// decompressed size is capped at maxSize as well so a small compressed frame
+// can't expand without bound.
+func decodePayload(frame Frame, maxSize int) ([]byte, error) {
+	switch frame.Flags {
+	case 0:
+		return frame.Payload, nil
+
+	case FlagGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(frame.Payload))
+		if err != nil {
+			return nil, &InvalidFrameError{Size: len(frame.Payload), Reason: fmt.Sprintf("invalid gzip frame: %v", err)}
+		}
+		defer gz.Close()
+
+		payload, err := io.ReadAll(io.LimitReader(gz, int64(maxSize)+1))
+		if err != nil {
+			return nil, &InvalidFrameError{Size: len(frame.Payload), Reason: fmt.Sprintf("invalid gzip frame: %v", err)}
+		}
+		if len(payload) > maxSize {
+			return nil, &InvalidFrameError{
+				Size:   len(frame.Payload),
+				Reason: fmt.Sprintf("decompressed frame exceeds limit of %d bytes", maxSize),
+			}
+		}
+		return payload, nil
+
+	default:
+		return nil, &InvalidFrameError{
+			Size:   len(frame.Payload),
+			Reason: fmt.Sprintf("unsupported frame flags 0x%02x", frame.Flags),
+		}
+	}
+}
+
+func newFrameCodec(protocolVersion int, conn net.Conn, r *bufio.Reader, maxSize int) (frameReader, frameWriter) {
+	if protocolVersion < 2 {
+		return &lineFrameReader{r: r, maxSize: maxSize}, &lineFrameWriter{conn: conn}
+	}
+	return &lengthFrameReader{r: r, maxSize: maxSize}, &lengthFrameWriter{conn: conn}
+}
@@ -0,0 +1,161 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func lengthFrame(flags byte, payload string) []byte {
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	buf[4] = flags
+	copy(buf[frameHeaderSize:], payload)
+	return buf
+}
+
+func TestLengthFrameRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	frames := []Frame{
+		{Payload: []byte(`{"server_name":"web-01"}`)},
+		{Flags: FlagGzip, Payload: []byte("\x1f\x8b compressed")},
+		{Payload: []byte("line one\nline two")},
+	}
+
+	go func() {
+		writer := &lengthFrameWriter{conn: client}
+		for _, frame := range frames {
+			writer.WriteFrame(frame)
+		}
+	}()
+
+	reader := &lengthFrameReader{r: bufio.NewReader(server), maxSize: 1024}
+	for _, want := range frames {
+		got, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame: %v", err)
+		}
+		if got.Flags != want.Flags || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("ReadFrame = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReadOversizedFrame(t *testing.T) {
+	const maxSize = 16
+	next := `{"ok":true}`
+
+	tests := []struct {
+		name      string
+		reader    func(stream []byte) frameReader
+		oversized []byte
+		following []byte
+		fatal     bool
+	}{
+		{
+			name: "length frame within the drain limit",
+			reader: func(stream []byte) frameReader {
+				return &lengthFrameReader{r: bufio.NewReader(bytes.NewReader(stream)), maxSize: maxSize}
+			},
+			oversized: lengthFrame(0, strings.Repeat("x", 20)),
+			following: lengthFrame(0, next),
+		},
+		{
+			name: "length frame beyond the drain limit",
+			reader: func(stream []byte) frameReader {
+				return &lengthFrameReader{r: bufio.NewReader(bytes.NewReader(stream)), maxSize: maxSize}
+			},
+			oversized: lengthFrame(0, strings.Repeat("x", 100)),
+			fatal:     true,
+		},
+		{
+			name: "header claiming 4GiB",
+			reader: func(stream []byte) frameReader {
+				return &lengthFrameReader{r: bufio.NewReader(bytes.NewReader(stream)), maxSize: maxSize}
+			},
+			oversized: []byte{0xff, 0xff, 0xff, 0xff, 0},
+			fatal:     true,
+		},
+		{
+			name: "line within the drain limit",
+			reader: func(stream []byte) frameReader {
+				return &lineFrameReader{r: bufio.NewReaderSize(bytes.NewReader(stream), 16), maxSize: maxSize}
+			},
+			oversized: []byte(strings.Repeat("x", 20) + "\n"),
+			following: []byte(next + "\n"),
+		},
+		{
+			name: "line beyond the drain limit",
+			reader: func(stream []byte) frameReader {
+				return &lineFrameReader{r: bufio.NewReaderSize(bytes.NewReader(stream), 16), maxSize: maxSize}
+			},
+			oversized: []byte(strings.Repeat("x", 100) + "\n"),
+			fatal:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := tt.reader(append(tt.oversized, tt.following...))
+
+			_, err := reader.ReadFrame()
+			var frameErr *InvalidFrameError
+			if !errors.As(err, &frameErr) {
+				t.Fatalf("ReadFrame error = %v, want an InvalidFrameError", err)
+			}
+			if frameErr.Fatal != tt.fatal {
+				t.Errorf("Fatal = %v, want %v", frameErr.Fatal, tt.fatal)
+			}
+			if tt.fatal {
+				return
+			}
+
+			frame, err := reader.ReadFrame()
+			if err != nil || string(frame.Payload) != next {
+				t.Errorf("frame after the oversized one = %q, %v, want %q", frame.Payload, err, next)
+			}
+			if _, err := reader.ReadFrame(); err != io.EOF {
+				t.Errorf("ReadFrame at the end = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		frame   Frame
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", frame: Frame{Payload: []byte("plain")}, want: "plain"},
+		{name: "gzip", frame: Frame{Flags: FlagGzip, Payload: gzipped(t, "compressed")}, want: "compressed"},
+		{name: "gzip expanding past the limit", frame: Frame{Flags: FlagGzip, Payload: gzipped(t, strings.Repeat("x", 64))}, wantErr: true},
+		{name: "invalid gzip", frame: Frame{Flags: FlagGzip, Payload: []byte("not gzip")}, wantErr: true},
+		{name: "unknown flags", frame: Frame{Flags: 0x80, Payload: []byte("x")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := decodePayload(tt.frame, 32)
+			if tt.wantErr {
+				var frameErr *InvalidFrameError
+				if !errors.As(err, &frameErr) {
+					t.Errorf("decodePayload error = %v, want an InvalidFrameError", err)
+				}
+				return
+			}
+			if err != nil || string(payload) != tt.want {
+				t.Errorf("decodePayload = %q, %v, want %q", payload, err, tt.want)
+			}
+		})
+	}
+}
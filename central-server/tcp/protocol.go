@@ -0,0 +1,96 @@
+package tcp
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	FrameHello   = "hello"
+	FrameHelloOK = "hello_ok"
+	FrameError   = "error"
+	FrameResync  = "resync"
+	FrameAck     = "ack"
+)
+
+// ProtocolVersion is the newest wire protocol the central speaks.
+// MinProtocolVersion is the oldest one it still accepts from agents.
+//
+// v1: newline-delimited JSON frames.
+// v2: length-prefixed frames, see frame.go.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// CapabilityGzip lets the agent send gzip compressed frames (FlagGzip).
+// CapabilityPaneDelta lets panes carry a types.PaneDelta instead of content.
+// CapabilityAck makes the central acknowledge every sequenced data frame.
+const (
+	CapabilityGzip      = "gzip"
+	CapabilityPaneDelta = "pane_delta"
+	CapabilityAck       = "ack"
+)
+
+// supportedCapabilities maps the optional protocol features the central
+// understands to the minimum protocol version they need. The hello reply
+// contains the subset the agent also offered.
+var supportedCapabilities = map[string]int{
+	CapabilityGzip:      2,
+	CapabilityPaneDelta: 1,
+	CapabilityAck:       2,
+}
+
+// Hello is the first line an agent sends on every connection.
+type Hello struct {
+	Type            string   `json:"type"`
+	ServerName      string   `json:"server_name"`
+	Token           string   `json:"token,omitempty"`
+	ProtocolVersion int      `json:"protocol_version"`
+	AgentVersion    string   `json:"agent_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	// AgentSession identifies one run of the agent process. Sequence
+	// numbers restart from 1 whenever it changes.
+	AgentSession string `json:"agent_session,omitempty"`
+}
+
+// Reply is sent by the central back to the agent.
+type Reply struct {
+	Type            string   `json:"type"`
+	Error           string   `json:"error,omitempty"`
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+	ServerVersion   string   `json:"server_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	MaxFrameSize    int      `json:"max_frame_size,omitempty"`
+	Panes           []string `json:"panes,omitempty"`
+	Seq             uint64   `json:"seq,omitempty"`
+}
+
+// negotiate picks the protocol version and capabilities for a connection.
+// Agents newer than the central are downgraded to ProtocolVersion; agents
+// older than MinProtocolVersion are refused.
+func negotiate(hello Hello) (int, []string, error) {
+	version := hello.ProtocolVersion
+	if version == 0 {
+		// NOTE: Agents from before versioning send no protocol_version, their framing is v1
+		version = 1
+	}
+
+	if version < MinProtocolVersion {
+		return 0, nil, fmt.Errorf("protocol version %d is no longer supported (central supports %d-%d), upgrade child-monitor",
+			version, MinProtocolVersion, ProtocolVersion)
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	capabilities := []string{}
+	for _, capability := range hello.Capabilities {
+		minVersion, ok := supportedCapabilities[capability]
+		if ok && version >= minVersion && !slices.Contains(capabilities, capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+
+	return version, capabilities, nil
+}
@@ -0,0 +1,88 @@
+package tcp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"slices"
+	"testing"
+)
+
+func gzipped(t *testing.T, payload string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(payload)); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNegotiate(t *testing.T) {
+	allCapabilities := []string{CapabilityGzip, CapabilityPaneDelta, CapabilityAck}
+
+	tests := []struct {
+		name             string
+		hello            Hello
+		wantVersion      int
+		wantCapabilities []string
+		wantErr          bool
+	}{
+		{
+			name:             "agent from before versioning",
+			hello:            Hello{},
+			wantVersion:      1,
+			wantCapabilities: []string{},
+		},
+		{
+			name:             "v1 agent only gets v1 capabilities",
+			hello:            Hello{ProtocolVersion: 1, Capabilities: allCapabilities},
+			wantVersion:      1,
+			wantCapabilities: []string{CapabilityPaneDelta},
+		},
+		{
+			name:             "v2 agent",
+			hello:            Hello{ProtocolVersion: 2, Capabilities: allCapabilities},
+			wantVersion:      2,
+			wantCapabilities: allCapabilities,
+		},
+		{
+			name:             "newer agent is downgraded",
+			hello:            Hello{ProtocolVersion: ProtocolVersion + 1, Capabilities: []string{CapabilityAck}},
+			wantVersion:      ProtocolVersion,
+			wantCapabilities: []string{CapabilityAck},
+		},
+		{
+			name:             "unknown and repeated capabilities are left out",
+			hello:            Hello{ProtocolVersion: 2, Capabilities: []string{"zstd", CapabilityGzip, CapabilityGzip}},
+			wantVersion:      2,
+			wantCapabilities: []string{CapabilityGzip},
+		},
+		{
+			name:    "agent older than the minimum",
+			hello:   Hello{ProtocolVersion: -1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, capabilities, err := negotiate(tt.hello)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("negotiate = %d, %v, want an error", version, capabilities)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("negotiate: %v", err)
+			}
+			if version != tt.wantVersion || !slices.Equal(capabilities, tt.wantCapabilities) {
+				t.Errorf("negotiate = %d, %v, want %d, %v", version, capabilities, tt.wantVersion, tt.wantCapabilities)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package tcp
 
 import (
 	"bufio"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"slices"
 	"time"
 
 	"central-server/types"
@@ -15,6 +19,15 @@ type TCPServer struct {
 	port          string
 	serverManager *types.ServerManager
 	broadcaster   chan types.ServerData
+	tlsConfig     *tls.Config
+	authenticator Authenticator
+	version       string
+	maxFrameSize  int
+}
+
+// Authenticator validates the token an agent presents in its hello frame.
+type Authenticator interface {
+	Authorize(token, serverName string) error
 }
 
 func NewTCPServer(port string, serverManager *types.ServerManager, broadcaster chan types.ServerData) *TCPServer {
@@ -22,16 +35,44 @@ func NewTCPServer(port string, serverManager *types.ServerManager, broadcaster c
 		port:          port,
 		serverManager: serverManager,
 		broadcaster:   broadcaster,
+		maxFrameSize:  DefaultMaxFrameSize,
 	}
 }
 
+func (s *TCPServer) SetTLSConfig(tlsConfig *tls.Config) {
+	s.tlsConfig = tlsConfig
+}
+
+func (s *TCPServer) SetServerVersion(version string) {
+	s.version = version
+}
+
+func (s *TCPServer) SetMaxFrameSize(size int) {
+	s.maxFrameSize = size
+}
+
+func (s *TCPServer) SetAuthenticator(authenticator Authenticator) {
+	s.authenticator = authenticator
+}
+
 func (s *TCPServer) Start() error {
-	listener, err := net.Listen("tcp", ":"+s.port)
+	var listener net.Listener
+	var err error
+
+	if s.tlsConfig != nil {
+		listener, err = tls.Listen("tcp", ":"+s.port, s.tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", ":"+s.port)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to start TCP server: %w", err)
 	}
 
-	log.Printf(" TCP server listening on port %s", s.port)
+	if s.tlsConfig != nil {
+		log.Printf(" TCP server listening on port %s (TLS)", s.port)
+	} else {
+		log.Printf(" TCP server listening on port %s", s.port)
+	}
 
 	for {
 		conn, err := listener.Accept()
@@ -50,23 +91,142 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 	clientAddr := conn.RemoteAddr().String()
 	log.Printf(" New connection from %s", clientAddr)
 
-	scanner := bufio.NewScanner(conn)
+	var identity *types.PeerIdentity
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := tlsConn.Handshake(); err != nil {
+			log.Printf(" TLS handshake failed with %s: %v", clientAddr, err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
+		identity = peerIdentity(tlsConn.ConnectionState())
+		if identity != nil {
+			log.Printf(" Verified client certificate for %s: %s", clientAddr, identity.Subject)
+		}
+	}
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	var writer frameWriter = &lineFrameWriter{conn: conn}
+
+	hello, err := s.readHello(conn, reader)
+	if err != nil {
+		log.Printf(" Rejected %s: %v", clientAddr, err)
+		s.sendReply(writer, Reply{Type: FrameError, Error: err.Error(), ServerVersion: s.version})
+		return
+	}
+
+	protocolVersion, capabilities, err := negotiate(*hello)
+	if err != nil {
+		log.Printf(" Rejected %s (agent %s): %v", clientAddr, hello.AgentVersion, err)
+		s.sendReply(writer, Reply{Type: FrameError, Error: err.Error(), ServerVersion: s.version})
+		return
+	}
+
+	s.sendReply(writer, Reply{
+		Type:            FrameHelloOK,
+		ProtocolVersion: protocolVersion,
+		ServerVersion:   s.version,
+		Capabilities:    capabilities,
+		MaxFrameSize:    s.maxFrameSize,
+	})
+	log.Printf(" Agent %s (%s, protocol v%d) authenticated from %s",
+		hello.ServerName, hello.AgentVersion, protocolVersion, clientAddr)
+
+	agent := &types.AgentInfo{
+		Version:         hello.AgentVersion,
+		ProtocolVersion: protocolVersion,
+		Capabilities:    capabilities,
+		RemoteAddr:      clientAddr,
+		ConnectedAt:     time.Now(),
+	}
+	registered := map[string]bool{hello.ServerName: true}
+	s.serverManager.RegisterAgent(hello.ServerName, agent, identity)
+
+	frames, writer := newFrameCodec(protocolVersion, conn, reader, s.maxFrameSize)
+
+	for {
+		frame, err := frames.ReadFrame()
+		if err != nil {
+			var frameErr *InvalidFrameError
+			if errors.As(err, &frameErr) {
+				log.Printf(" Rejected frame from %s (%s): %v", hello.ServerName, clientAddr, frameErr)
+				s.serverManager.RecordRejectedFrame(hello.ServerName, frameErr.Reason)
+				s.sendReply(writer, Reply{Type: FrameError, Error: frameErr.Reason})
+				if frameErr.Fatal {
+					break
+				}
+				continue
+			}
+
+			if !errors.Is(err, io.EOF) {
+				log.Printf("Connection error with %s: %v", clientAddr, err)
+			}
+			break
+		}
+
+		if len(frame.Payload) == 0 {
+			continue
+		}
+
+		payload, err := decodePayload(frame, s.maxFrameSize)
+		if err == nil && frame.Flags&FlagGzip != 0 && !slices.Contains(capabilities, CapabilityGzip) {
+			err = fmt.Errorf("gzip frames were not negotiated")
+		}
+		if err != nil {
+			s.serverManager.RecordRejectedFrame(hello.ServerName, err.Error())
+			s.sendReply(writer, Reply{Type: FrameError, Error: err.Error()})
 			continue
 		}
 
 		var data types.ServerData
-		if err := json.Unmarshal([]byte(line), &data); err != nil {
+		if err := json.Unmarshal(payload, &data); err != nil {
 			log.Printf("Failed to parse data from %s: %v", clientAddr, err)
+			s.serverManager.RecordRejectedFrame(hello.ServerName, "invalid JSON payload")
+			s.sendReply(writer, Reply{Type: FrameError, Error: fmt.Sprintf("invalid JSON payload: %v", err)})
 			continue
 		}
 
-		data.Timestamp = time.Now()
+		if data.ServerName != hello.ServerName {
+			if err := s.authorize(hello.Token, data.ServerName); err != nil {
+				log.Printf(" Dropping data for %s from %s: %v", data.ServerName, clientAddr, err)
+				s.serverManager.RecordRejectedFrame(hello.ServerName, err.Error())
+				s.sendReply(writer, Reply{Type: FrameError, Error: fmt.Sprintf("%s: %v", data.ServerName, err)})
+				continue
+			}
+		}
+
+		// NOTE: Skipping a duplicate leaves the delta base alone, agents send replayed frames whole and follow them with keyframes
+		acked := data.Seq > 0 && slices.Contains(capabilities, CapabilityAck)
+		if acked && !s.serverManager.AcceptSequence(data.ServerName, hello.AgentSession, data.Seq) {
+			s.sendReply(writer, Reply{Type: FrameAck, Seq: data.Seq})
+			continue
+		}
+
+		// NOTE: Replayed samples keep the agent's timestamp so outages don't leave a hole in history
+		if !data.Replayed || data.Timestamp.IsZero() || data.Timestamp.After(time.Now()) {
+			data.Timestamp = time.Now()
+		}
+
+		if resync := s.serverManager.ApplyPaneDeltas(&data); len(resync) > 0 {
+			log.Printf(" Requesting keyframes for %d panes from %s", len(resync), data.ServerName)
+			s.sendReply(writer, Reply{Type: FrameResync, Panes: resync})
+		}
+
+		for _, event := range data.PaneEvents {
+			log.Printf(" Pane %s %s on %s (window %s)", event.PaneID, event.Type, data.ServerName, event.WindowName)
+		}
 
 		s.serverManager.UpdateServer(data)
+		if !registered[data.ServerName] {
+			registered[data.ServerName] = true
+			s.serverManager.RegisterAgent(data.ServerName, agent, identity)
+		}
+		s.serverManager.RecordFrame(data.ServerName, len(payload), len(frame.Payload))
+
+		if acked {
+			s.sendReply(writer, Reply{Type: FrameAck, Seq: data.Seq})
+		}
 
 		select {
 		case s.broadcaster <- data:
@@ -74,9 +234,52 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("Connection error with %s: %v", clientAddr, err)
+	log.Printf(" Connection closed: %s", clientAddr)
+}
+
+func (s *TCPServer) readHello(conn net.Conn, reader *bufio.Reader) (*Hello, error) {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	lines := &lineFrameReader{r: reader, maxSize: maxHelloSize}
+	frame, err := lines.ReadFrame()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("connection closed before hello")
+		}
+		return nil, fmt.Errorf("failed to read hello: %w", err)
+	}
+
+	var hello Hello
+	if err := json.Unmarshal(frame.Payload, &hello); err != nil || hello.Type != FrameHello {
+		return nil, fmt.Errorf("expected hello frame")
 	}
 
-	log.Printf(" Connection closed: %s", clientAddr)
+	if hello.ServerName == "" {
+		return nil, fmt.Errorf("hello is missing server_name")
+	}
+
+	if err := s.authorize(hello.Token, hello.ServerName); err != nil {
+		return nil, err
+	}
+
+	return &hello, nil
+}
+
+func (s *TCPServer) authorize(token, serverName string) error {
+	if s.authenticator == nil {
+		return nil
+	}
+	return s.authenticator.Authorize(token, serverName)
+}
+
+func (s *TCPServer) sendReply(writer frameWriter, reply Reply) {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+
+	if err := writer.WriteFrame(Frame{Payload: data}); err != nil {
+		log.Printf("Failed to send %s reply: %v", reply.Type, err)
+	}
 }
@@ -0,0 +1,60 @@
+package tcp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"central-server/types"
+)
+
+// LoadTLSConfig builds the listener TLS config. When clientCAFile is set,
+// agents must present a certificate signed by that CA or the handshake fails.
+func LoadTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		caPEM, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", clientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func peerIdentity(state tls.ConnectionState) *types.PeerIdentity {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := state.VerifiedChains[0][0]
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	return &types.PeerIdentity{
+		Subject:     cert.Subject.String(),
+		CommonName:  cert.Subject.CommonName,
+		Issuer:      cert.Issuer.String(),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		NotAfter:    cert.NotAfter,
+	}
+}
@@ -0,0 +1,105 @@
+package types
+
+import (
+	"hash/crc32"
+	"strings"
+)
+
+// PaneDelta is sent by agents in place of TmuxPane.Content when only some
+// lines changed. BaseHash is the CRC32 of the content it applies to.
+type PaneDelta struct {
+	BaseHash  uint32       `json:"base_hash"`
+	Unchanged bool         `json:"unchanged,omitempty"`
+	LineCount int          `json:"line_count,omitempty"`
+	Lines     []LineChange `json:"lines,omitempty"`
+}
+
+type LineChange struct {
+	Index int    `json:"i"`
+	Text  string `json:"t"`
+}
+
+func (d *PaneDelta) apply(base string) string {
+	if d.Unchanged {
+		return base
+	}
+
+	baseLines := strings.Split(base, "\n")
+	lines := make([]string, d.LineCount)
+	copy(lines, baseLines)
+
+	for _, change := range d.Lines {
+		if change.Index >= 0 && change.Index < len(lines) {
+			lines[change.Index] = change.Text
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ApplyPaneDeltas rebuilds full pane content from deltas against the latest
+// stored sample for the server, and fills in scrollback the agent left out
+// as unchanged. The agent owns the base: it starts over with keyframes on
+// every connection and after replaying frames, which it always sends whole. It returns the IDs of panes whose base no longer matches;
+// those keep their previous content and the agent should be asked for a
+// keyframe.
+func (sm *ServerManager) ApplyPaneDeltas(data *ServerData) []string {
+	var previous map[string]TmuxPane
+	var resync []string
+
+	for i := range data.TmuxPanes {
+		pane := &data.TmuxPanes[i]
+		if pane.Delta == nil && pane.ScrollbackHash == 0 {
+			continue
+		}
+
+		if previous == nil {
+			previous = sm.latestPanes(data.ServerName)
+		}
+		base, exists := previous[pane.ID]
+		stale := false
+
+		if pane.ScrollbackHash != 0 {
+			if !exists || crc32.ChecksumIEEE([]byte(base.Scrollback)) != pane.ScrollbackHash {
+				stale = true
+			}
+			pane.Scrollback = base.Scrollback
+			pane.ScrollbackHash = 0
+		}
+
+		if pane.Delta != nil {
+			if !exists || crc32.ChecksumIEEE([]byte(base.Content)) != pane.Delta.BaseHash {
+				stale = true
+				pane.Content = base.Content
+			} else {
+				pane.Content = pane.Delta.apply(base.Content)
+			}
+			pane.Delta = nil
+		}
+
+		if stale {
+			resync = append(resync, pane.ID)
+		}
+	}
+
+	return resync
+}
+
+func (sm *ServerManager) latestPanes(serverName string) map[string]TmuxPane {
+	panes := make(map[string]TmuxPane)
+
+	server := sm.GetServer(serverName)
+	if server == nil {
+		return panes
+	}
+
+	latest := server.GetLatestData()
+	if latest == nil {
+		return panes
+	}
+
+	for _, pane := range latest.TmuxPanes {
+		panes[pane.ID] = pane
+	}
+	return panes
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"slices"
+	"testing"
+)
+
+func TestApplyPaneDeltas(t *testing.T) {
+	base := "$ make\nbuilding\n"
+	baseHash := crc32.ChecksumIEEE([]byte(base))
+
+	tests := []struct {
+		name           string
+		pane           string // as sent by the agent
+		wantContent    string
+		wantScrollback string
+		wantResync     bool
+	}{
+		{
+			name:        "keyframe",
+			pane:        `{"id":"%0","content":"fresh\n"}`,
+			wantContent: "fresh\n",
+		},
+		{
+			name:        "unchanged",
+			pane:        `{"id":"%0","delta":{"base_hash":` + jsonHash(baseHash) + `,"unchanged":true}}`,
+			wantContent: base,
+		},
+		{
+			name:        "changed line",
+			pane:        `{"id":"%0","delta":{"base_hash":` + jsonHash(baseHash) + `,"line_count":3,"lines":[{"i":1,"t":"done"}]}}`,
+			wantContent: "$ make\ndone\n",
+		},
+		{
+			name:        "base mismatch keeps the previous content",
+			pane:        `{"id":"%0","delta":{"base_hash":1,"line_count":3,"lines":[{"i":1,"t":"done"}]}}`,
+			wantContent: base,
+			wantResync:  true,
+		},
+		{
+			name:        "unknown pane",
+			pane:        `{"id":"%9","delta":{"base_hash":` + jsonHash(baseHash) + `,"unchanged":true}}`,
+			wantContent: "",
+			wantResync:  true,
+		},
+		{
+			name:           "unchanged scrollback",
+			pane:           `{"id":"%0","content":"new\n","scrollback_hash":` + jsonHash(crc32.ChecksumIEEE([]byte("history\n"))) + `}`,
+			wantContent:    "new\n",
+			wantScrollback: "history\n",
+		},
+		{
+			name:           "scrollback mismatch",
+			pane:           `{"id":"%0","content":"new\n","scrollback_hash":1}`,
+			wantContent:    "new\n",
+			wantScrollback: "history\n",
+			wantResync:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewServerManager()
+			sm.UpdateServer(ServerData{ServerName: "web-01", TmuxPanes: []TmuxPane{{ID: "%0", Content: base, Scrollback: "history\n"}}})
+
+			var pane TmuxPane
+			if err := json.Unmarshal([]byte(tt.pane), &pane); err != nil {
+				t.Fatalf("invalid pane %s: %v", tt.pane, err)
+			}
+			data := ServerData{ServerName: "web-01", TmuxPanes: []TmuxPane{pane}}
+
+			resync := sm.ApplyPaneDeltas(&data)
+			got := data.TmuxPanes[0]
+			if got.Content != tt.wantContent || got.Delta != nil {
+				t.Errorf("content = %q, delta %+v, want %q", got.Content, got.Delta, tt.wantContent)
+			}
+			if got.Scrollback != tt.wantScrollback || got.ScrollbackHash != 0 {
+				t.Errorf("scrollback = %q, hash %d, want %q", got.Scrollback, got.ScrollbackHash, tt.wantScrollback)
+			}
+			if slices.Contains(resync, pane.ID) != tt.wantResync {
+				t.Errorf("resync = %v, want %s included: %v", resync, pane.ID, tt.wantResync)
+			}
+		})
+	}
+}
+
+func jsonHash(hash uint32) string {
+	data, _ := json.Marshal(hash)
+	return string(data)
+}
@@ -13,11 +13,75 @@ const (
 	StateDead   ServerState = "dead"   // 10+ seconds no data
 )
 
+// SystemStats from older agents only carry CPU, Memory and Disk, the
+// other fields stay zero.
 type SystemStats struct {
 	Timestamp time.Time `json:"timestamp"`
 	CPU       float64   `json:"cpu_percent"`
+	CPUCores  []float64 `json:"cpu_cores,omitempty"`
+	CPUTimes  CPUTimes  `json:"cpu_times"`
+	Load      LoadStats `json:"load"`
 	Memory    MemStats  `json:"memory"`
-	Disk      DiskStats `json:"disk"`
+	Swap      SwapStats `json:"swap"`
+	// Disk is the root filesystem, Disks every mount the agent reports,
+	// by mount point.
+	Disk      DiskStats   `json:"disk"`
+	Disks     []DiskStats `json:"disks,omitempty"`
+	Processes int         `json:"processes"`
+	Threads   int         `json:"threads"`
+	Uptime    uint64      `json:"uptime_seconds"`
+
+	Network []NetStats    `json:"network,omitempty"`
+	DiskIO  []DiskIOStats `json:"disk_io,omitempty"`
+}
+
+// CPUTimes is the CPU time since the agent's previous sample by state, in
+// percent of all cores.
+type CPUTimes struct {
+	User    float64 `json:"user"`
+	System  float64 `json:"system"`
+	Nice    float64 `json:"nice"`
+	IOWait  float64 `json:"iowait"`
+	IRQ     float64 `json:"irq"`
+	SoftIRQ float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Idle    float64 `json:"idle"`
+}
+
+type LoadStats struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// NetStats is one network interface's traffic per second since the agent's
+// previous sample.
+type NetStats struct {
+	Interface       string  `json:"interface"`
+	RxBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   float64 `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float64 `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float64 `json:"tx_packets_per_sec"`
+	RxErrorsPerSec  float64 `json:"rx_errors_per_sec"`
+	TxErrorsPerSec  float64 `json:"tx_errors_per_sec"`
+}
+
+// DiskIOStats is one block device's throughput since the agent's previous
+// sample.
+type DiskIOStats struct {
+	Device             string  `json:"device"`
+	ReadBytesPerSec    float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec   float64 `json:"write_bytes_per_sec"`
+	ReadIOPS           float64 `json:"read_iops"`
+	WriteIOPS          float64 `json:"write_iops"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+type SwapStats struct {
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Free    uint64  `json:"free"`
+	Percent float64 `json:"percent"`
 }
 
 type MemStats struct {
@@ -27,36 +91,171 @@ type MemStats struct {
 	Percent   float64 `json:"percent"`
 }
 
+// DiskStats is the usage of one mounted filesystem. Older agents only send
+// the root filesystem, without mount point or inodes.
 type DiskStats struct {
-	Total   uint64  `json:"total"`
-	Free    uint64  `json:"free"`
-	Used    uint64  `json:"used"`
-	Percent float64 `json:"percent"`
+	Mountpoint    string  `json:"mountpoint,omitempty"`
+	Device        string  `json:"device,omitempty"`
+	FSType        string  `json:"fstype,omitempty"`
+	Total         uint64  `json:"total"`
+	Free          uint64  `json:"free"`
+	Used          uint64  `json:"used"`
+	Percent       float64 `json:"percent"`
+	InodesTotal   uint64  `json:"inodes_total"`
+	InodesUsed    uint64  `json:"inodes_used"`
+	InodesFree    uint64  `json:"inodes_free"`
+	InodesPercent float64 `json:"inodes_percent"`
 }
 
+// TmuxPane IDs from panes on a named tmux socket are prefixed with the
+// socket by the agent, e.g. "build/%3", so they are unique per server.
 type TmuxPane struct {
-	ID        string `json:"id"`
-	WindowID  string `json:"window_id"`
-	SessionID string `json:"session_id"`
-	Content   string `json:"content"`
-	Active    bool   `json:"active"`
+	ID          string     `json:"id"`
+	WindowID    string     `json:"window_id"`
+	WindowName  string     `json:"window_name,omitempty"`
+	SessionID   string     `json:"session_id"`
+	SessionName string     `json:"session_name,omitempty"`
+	Content     string     `json:"content"`
+	Delta       *PaneDelta `json:"delta,omitempty"`
+	// Scrollback is the history above the visible Content. Agents leave it
+	// out and set ScrollbackHash when it is unchanged.
+	Scrollback     string `json:"scrollback,omitempty"`
+	ScrollbackHash uint32 `json:"scrollback_hash,omitempty"`
+	Active         bool   `json:"active"`
+	CurrentCommand string `json:"current_command,omitempty"`
+	PID            int    `json:"pid,omitempty"`
+	CurrentPath    string `json:"current_path,omitempty"`
+	Title          string `json:"title,omitempty"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	Left           int    `json:"left"`
+	Top            int    `json:"top"`
+	Dead           bool   `json:"dead,omitempty"`
+	Socket         string `json:"socket,omitempty"`
+	// Privacy "metadata" marks panes the agent never sends content for,
+	// they are kept as placeholders with LastActivity in unix seconds.
+	Privacy      string `json:"privacy,omitempty"`
+	LastActivity int64  `json:"last_activity,omitempty"`
+	// Usage is what the pane's process tree uses, nil from older agents.
+	Usage *PaneUsage `json:"usage,omitempty"`
+}
+
+// PaneUsage adds up the processes running in a pane, Top are its children
+// using the most CPU.
+type PaneUsage struct {
+	CPUPercent float64        `json:"cpu_percent"`
+	RSS        uint64         `json:"rss"`
+	Threads    int            `json:"threads"`
+	Processes  int            `json:"processes"`
+	Top        []ProcessUsage `json:"top,omitempty"`
+}
+
+type ProcessUsage struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
 }
 
 type ServerData struct {
-	ServerName  string      `json:"server_name"`
-	Timestamp   time.Time   `json:"timestamp"`
-	SystemStats SystemStats `json:"system_stats"`
-	TmuxPanes   []TmuxPane  `json:"tmux_panes"`
+	ServerName  string       `json:"server_name"`
+	Seq         uint64       `json:"seq,omitempty"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Replayed    bool         `json:"replayed,omitempty"`
+	SystemStats SystemStats  `json:"system_stats"`
+	TmuxPanes   []TmuxPane   `json:"tmux_panes"`
+	Windows     []TmuxWindow `json:"windows,omitempty"`
+	// SessionName is the first monitored session, sent by older agents
+	// that only monitor one. Panes carry their own session since.
 	SessionName string      `json:"session_name"`
+	PaneEvents  []PaneEvent `json:"pane_events,omitempty"`
+	// TopProcesses is only sent every few samples, by agents configured to.
+	TopProcesses *TopProcesses `json:"top_processes,omitempty"`
+}
+
+// TopProcesses are the processes using the most CPU and memory on a server
+// when the agent listed them. Commands are truncated and redacted.
+type TopProcesses struct {
+	Timestamp time.Time     `json:"timestamp"`
+	ByCPU     []ProcessInfo `json:"by_cpu"`
+	ByMemory  []ProcessInfo `json:"by_memory"`
+}
+
+type ProcessInfo struct {
+	PID        int32   `json:"pid"`
+	User       string  `json:"user,omitempty"`
+	Command    string  `json:"command"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
+	State      string  `json:"state,omitempty"`
 }
 
+// PaneEvent is a pane appearing in or disappearing from what an agent
+// monitors, e.g. after a window split or a session restart.
+type PaneEvent struct {
+	Type       string    `json:"type"`
+	PaneID     string    `json:"pane_id"`
+	WindowID   string    `json:"window_id"`
+	WindowName string    `json:"window_name,omitempty"`
+	SessionID  string    `json:"session_id"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// PeerIdentity is the verified client certificate an agent connected with.
+type PeerIdentity struct {
+	Subject     string    `json:"subject"`
+	CommonName  string    `json:"common_name"`
+	Issuer      string    `json:"issuer"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// AgentInfo describes the child-monitor on the most recent connection.
+type AgentInfo struct {
+	Version         string    `json:"version"`
+	ProtocolVersion int       `json:"protocol_version"`
+	Capabilities    []string  `json:"capabilities"`
+	RemoteAddr      string    `json:"remote_addr"`
+	ConnectedAt     time.Time `json:"connected_at"`
+}
+
+// IngestStats counts frames received from a server's agent. RawBytes is
+// the decoded payload size, WireBytes what actually crossed the network.
+type IngestStats struct {
+	FramesReceived   uint64    `json:"frames_received"`
+	FramesRejected   uint64    `json:"frames_rejected"`
+	RawBytes         uint64    `json:"raw_bytes"`
+	WireBytes        uint64    `json:"wire_bytes"`
+	LastRejectReason string    `json:"last_reject_reason,omitempty"`
+	LastRejectedAt   time.Time `json:"last_rejected_at"`
+}
+
+// DeliveryState tracks the last sequence number stored for a server so
+// frames the agent replays after a reconnect are only stored once.
+type DeliveryState struct {
+	AgentSession      string `json:"agent_session"`
+	LastSeq           uint64 `json:"last_seq"`
+	DuplicatesDropped uint64 `json:"duplicates_dropped"`
+}
+
+// maxPaneEvents is how many pane appear/disappear events are kept per server.
+const maxPaneEvents = 100
+
 type ServerInfo struct {
-	Name        string       `json:"name"`
-	State       ServerState  `json:"state"`
-	LastSeen    time.Time    `json:"last_seen"`
-	IsOnline    bool         `json:"is_online"`
-	DataHistory []ServerData `json:"data_history"`
-	mutex       sync.RWMutex `json:"-"`
+	Name       string        `json:"name"`
+	State      ServerState   `json:"state"`
+	LastSeen   time.Time     `json:"last_seen"`
+	IsOnline   bool          `json:"is_online"`
+	Agent      *AgentInfo    `json:"agent,omitempty"`
+	Identity   *PeerIdentity `json:"identity,omitempty"`
+	Ingest     IngestStats   `json:"ingest"`
+	Delivery   DeliveryState `json:"delivery"`
+	Sessions   []TmuxSession `json:"sessions"`
+	PaneEvents []PaneEvent   `json:"pane_events"`
+	// TopProcesses is the latest list the agent sent, kept out of the history.
+	TopProcesses *TopProcesses `json:"top_processes,omitempty"`
+	DataHistory  []ServerData  `json:"data_history"`
+	mutex        sync.RWMutex  `json:"-"`
 }
 
 func (s *ServerInfo) AddData(data ServerData) {
@@ -64,6 +263,25 @@ func (s *ServerInfo) AddData(data ServerData) {
 	defer s.mutex.Unlock()
 
 	s.LastSeen = time.Now()
+
+	// NOTE: Replayed samples may carry lists older than the one already kept
+	if data.TopProcesses != nil {
+		if s.TopProcesses == nil || !data.TopProcesses.Timestamp.Before(s.TopProcesses.Timestamp) {
+			s.TopProcesses = data.TopProcesses
+		}
+		data.TopProcesses = nil
+	}
+
+	// NOTE: Only the latest sample keeps scrollback, it is big and only shown for the current screen
+	if len(s.DataHistory) > 0 {
+		previous := &s.DataHistory[len(s.DataHistory)-1]
+		panes := make([]TmuxPane, len(previous.TmuxPanes))
+		copy(panes, previous.TmuxPanes)
+		for i := range panes {
+			panes[i].Scrollback = ""
+		}
+		previous.TmuxPanes = panes
+	}
 	s.DataHistory = append(s.DataHistory, data)
 
 	// NOTE: Keep 30 page of history for each server
@@ -71,6 +289,16 @@ func (s *ServerInfo) AddData(data ServerData) {
 		s.DataHistory = s.DataHistory[1:]
 	}
 
+	s.Sessions = GroupBySession(data)
+
+	for _, event := range data.PaneEvents {
+		event.Timestamp = data.Timestamp
+		s.PaneEvents = append(s.PaneEvents, event)
+	}
+	if len(s.PaneEvents) > maxPaneEvents {
+		s.PaneEvents = s.PaneEvents[len(s.PaneEvents)-maxPaneEvents:]
+	}
+
 	s.updateState()
 }
 
@@ -84,6 +312,71 @@ func (s *ServerInfo) GetLatestData() *ServerData {
 	return &s.DataHistory[len(s.DataHistory)-1]
 }
 
+// GetStatsHistory returns the system stats of every sample in the history,
+// oldest first, without the pane content.
+func (s *ServerInfo) GetStatsHistory() []SystemStats {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	history := make([]SystemStats, len(s.DataHistory))
+	for i, data := range s.DataHistory {
+		history[i] = data.SystemStats
+	}
+	return history
+}
+
+// GetTopProcesses returns the latest top process lists, nil if the agent
+// never sent any.
+func (s *ServerInfo) GetTopProcesses() *TopProcesses {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.TopProcesses
+}
+
+func (s *ServerInfo) SetAgent(agent *AgentInfo, identity *PeerIdentity) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Agent = agent
+	s.Identity = identity
+}
+
+func (s *ServerInfo) RecordFrame(rawSize, wireSize int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Ingest.FramesReceived++
+	s.Ingest.RawBytes += uint64(rawSize)
+	s.Ingest.WireBytes += uint64(wireSize)
+}
+
+func (s *ServerInfo) RecordRejectedFrame(reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.Ingest.FramesRejected++
+	s.Ingest.LastRejectReason = reason
+	s.Ingest.LastRejectedAt = time.Now()
+}
+
+// AcceptSequence reports whether seq is new for agentSession, recording it
+// if so.
+func (s *ServerInfo) AcceptSequence(agentSession string, seq uint64) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.Delivery.AgentSession != agentSession {
+		s.Delivery.AgentSession = agentSession
+		s.Delivery.LastSeq = seq
+		return true
+	}
+
+	if seq <= s.Delivery.LastSeq {
+		s.Delivery.DuplicatesDropped++
+		return false
+	}
+
+	s.Delivery.LastSeq = seq
+	return true
+}
+
 func (s *ServerInfo) GetState() ServerState {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -155,19 +448,23 @@ func (sm *ServerManager) LoadFromStorage() error {
 	return nil
 }
 
-func (sm *ServerManager) UpdateServer(data ServerData) {
-	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
-
-	server, exists := sm.servers[data.ServerName]
+func (sm *ServerManager) getOrCreateServer(name string) *ServerInfo {
+	server, exists := sm.servers[name]
 	if !exists {
 		server = &ServerInfo{
-			Name:        data.ServerName,
+			Name:        name,
 			DataHistory: make([]ServerData, 0, 10),
 		}
-		sm.servers[data.ServerName] = server
+		sm.servers[name] = server
 	}
+	return server
+}
 
+func (sm *ServerManager) UpdateServer(data ServerData) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	server := sm.getOrCreateServer(data.ServerName)
 	server.AddData(data)
 
 	if sm.storage != nil {
@@ -179,6 +476,36 @@ func (sm *ServerManager) UpdateServer(data ServerData) {
 	}
 }
 
+// RegisterAgent records which agent (and verified certificate, if any) is
+// reporting as name, creating the server entry on first contact.
+func (sm *ServerManager) RegisterAgent(name string, agent *AgentInfo, identity *PeerIdentity) {
+	sm.mutex.Lock()
+	server := sm.getOrCreateServer(name)
+	sm.mutex.Unlock()
+
+	server.SetAgent(agent, identity)
+}
+
+func (sm *ServerManager) AcceptSequence(name, agentSession string, seq uint64) bool {
+	sm.mutex.Lock()
+	server := sm.getOrCreateServer(name)
+	sm.mutex.Unlock()
+
+	return server.AcceptSequence(agentSession, seq)
+}
+
+func (sm *ServerManager) RecordFrame(name string, rawSize, wireSize int) {
+	if server := sm.GetServer(name); server != nil {
+		server.RecordFrame(rawSize, wireSize)
+	}
+}
+
+func (sm *ServerManager) RecordRejectedFrame(name, reason string) {
+	if server := sm.GetServer(name); server != nil {
+		server.RecordRejectedFrame(reason)
+	}
+}
+
 func (sm *ServerManager) GetAllServers() map[string]*ServerInfo {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
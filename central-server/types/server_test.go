@@ -0,0 +1,50 @@
+package types
+
+import "testing"
+
+func TestAcceptSequence(t *testing.T) {
+	type frame struct {
+		session string
+		seq     uint64
+		accept  bool
+	}
+
+	tests := []struct {
+		name           string
+		frames         []frame
+		wantDuplicates uint64
+	}{
+		{
+			name:   "in order",
+			frames: []frame{{"a", 1, true}, {"a", 2, true}, {"a", 3, true}},
+		},
+		{
+			name:           "replayed after a reconnect",
+			frames:         []frame{{"a", 1, true}, {"a", 2, true}, {"a", 1, false}, {"a", 2, false}, {"a", 3, true}},
+			wantDuplicates: 2,
+		},
+		{
+			name:           "gap from frames the agent dropped",
+			frames:         []frame{{"a", 1, true}, {"a", 5, true}, {"a", 4, false}},
+			wantDuplicates: 1,
+		},
+		{
+			name:   "restarted agent starts over at 1",
+			frames: []frame{{"a", 1, true}, {"a", 2, true}, {"b", 1, true}, {"b", 2, true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &ServerInfo{Name: "web-01"}
+			for i, f := range tt.frames {
+				if got := server.AcceptSequence(f.session, f.seq); got != f.accept {
+					t.Errorf("frame %d (%s #%d): accepted = %v, want %v", i, f.session, f.seq, got, f.accept)
+				}
+			}
+			if server.Delivery.DuplicatesDropped != tt.wantDuplicates {
+				t.Errorf("duplicates dropped = %d, want %d", server.Delivery.DuplicatesDropped, tt.wantDuplicates)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package types
+
+import "sort"
+
+// TmuxWindow is a tmux window with its layout. Agents send it without
+// panes; in ServerInfo.Sessions it holds the panes it contains.
+type TmuxWindow struct {
+	ID        string     `json:"id"`
+	Index     int        `json:"index"`
+	Name      string     `json:"name"`
+	SessionID string     `json:"session_id"`
+	Active    bool       `json:"active"`
+	Width     int        `json:"width"`
+	Height    int        `json:"height"`
+	Layout    string     `json:"layout"`
+	Socket    string     `json:"socket,omitempty"`
+	Panes     []TmuxPane `json:"panes,omitempty"`
+}
+
+// TmuxSession is the session → window → pane tree of the latest sample,
+// with pane geometry but without content or scrollback, which stay in the
+// data history.
+type TmuxSession struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Socket  string       `json:"socket,omitempty"`
+	Windows []TmuxWindow `json:"windows"`
+}
+
+// GroupBySession builds the session tree for data. Older agents don't send
+// windows, those get a window with only its ID.
+func GroupBySession(data ServerData) []TmuxSession {
+	windowInfo := make(map[string]TmuxWindow, len(data.Windows))
+	for _, window := range data.Windows {
+		windowInfo[window.ID] = window
+	}
+
+	var sessions []TmuxSession
+	sessionIndex := make(map[string]int)
+	windowIndex := make(map[string]int)
+
+	for _, pane := range data.TmuxPanes {
+		si, exists := sessionIndex[pane.SessionID]
+		if !exists {
+			name := pane.SessionName
+			if name == "" {
+				name = data.SessionName
+			}
+			si = len(sessions)
+			sessionIndex[pane.SessionID] = si
+			sessions = append(sessions, TmuxSession{ID: pane.SessionID, Name: name, Socket: pane.Socket})
+		}
+		session := &sessions[si]
+
+		wi, exists := windowIndex[pane.WindowID]
+		if !exists {
+			window, known := windowInfo[pane.WindowID]
+			if !known {
+				window = TmuxWindow{ID: pane.WindowID, Name: pane.WindowName, SessionID: pane.SessionID, Socket: pane.Socket}
+			}
+			window.Panes = nil
+			wi = len(session.Windows)
+			windowIndex[pane.WindowID] = wi
+			session.Windows = append(session.Windows, window)
+		}
+
+		pane.Content = ""
+		pane.Delta = nil
+		pane.Scrollback = ""
+		session.Windows[wi].Panes = append(session.Windows[wi].Panes, pane)
+	}
+
+	for i := range sessions {
+		sort.SliceStable(sessions[i].Windows, func(a, b int) bool {
+			return sessions[i].Windows[a].Index < sessions[i].Windows[b].Index
+		})
+	}
+
+	return sessions
+}
@@ -0,0 +1,307 @@
+package agent
+
+import (
+	"hash/crc32"
+	"strings"
+	"time"
+
+	"child-monitor/collector"
+	"child-monitor/network"
+	"child-monitor/redact"
+	"child-monitor/tmux"
+)
+
+// Collector turns the state of a tmux backend into samples. It resolves
+// the selection rules, keeps pane metadata fresh and captures content,
+// either directly or through a control mode watcher.
+type Collector struct {
+	backend         tmux.Backend
+	resolver        *tmux.Resolver
+	watcher         *tmux.Watcher
+	redactor        *redact.Redactor
+	processes       *collector.ProcessSampler
+	scrollbackLimit int
+
+	panes      []tmux.Pane
+	metadata   map[string]tmux.Pane
+	activity   map[string]paneActivity
+	windows    []tmux.Window
+	events     []network.PaneEvent
+	rediscover bool
+}
+
+// paneActivity tracks when a metadata only pane's screen last changed,
+// by hash so its content isn't kept around.
+type paneActivity struct {
+	hash uint32
+	last int64
+}
+
+// Sample is one round of collected panes, plus the pane events queued
+// since the previous one.
+type Sample struct {
+	Panes      []network.TmuxPane
+	Windows    []network.TmuxWindow
+	PaneEvents []network.PaneEvent
+}
+
+func NewCollector(backend tmux.Backend, resolver *tmux.Resolver, scrollbackLimit int) *Collector {
+	return &Collector{
+		backend:         backend,
+		resolver:        resolver,
+		scrollbackLimit: scrollbackLimit,
+		activity:        make(map[string]paneActivity),
+		rediscover:      true,
+	}
+}
+
+// SetWatcher makes Collect read panes from a control mode watcher instead
+// of capturing them through the backend.
+func (c *Collector) SetWatcher(watcher *tmux.Watcher) {
+	c.watcher = watcher
+}
+
+// SetRedactor makes Collect redact secrets from pane content and titles.
+func (c *Collector) SetRedactor(redactor *redact.Redactor) {
+	c.redactor = redactor
+}
+
+// SetProcessSampler makes Collect attach the resource usage of each pane's
+// process tree. The process snapshot is refreshed along with metadata.
+func (c *Collector) SetProcessSampler(processes *collector.ProcessSampler) {
+	c.processes = processes
+}
+
+// Panes returns the panes matched by the last Discover.
+func (c *Collector) Panes() []tmux.Pane {
+	return c.panes
+}
+
+// Rediscover asks for the rules to be re-resolved before the next sample.
+func (c *Collector) Rediscover() {
+	c.rediscover = true
+}
+
+// NeedsDiscovery reports whether Rediscover was called, or a pane failed to
+// capture, since the last Discover.
+func (c *Collector) NeedsDiscovery() bool {
+	return c.rediscover
+}
+
+// Discover re-resolves the selection rules and queues an event for every
+// pane that appeared or disappeared. On error the previous panes are kept.
+func (c *Collector) Discover() (tmux.Changes, error) {
+	changes, err := c.resolver.Resolve()
+	if err != nil {
+		return tmux.Changes{}, err
+	}
+
+	c.panes = changes.Panes
+	c.rediscover = false
+	c.metadata = nil
+
+	c.queueEvents(network.PaneAdded, changes.Added)
+	c.queueEvents(network.PaneRemoved, changes.Removed)
+
+	return changes, nil
+}
+
+func (c *Collector) queueEvents(eventType string, panes []tmux.Pane) {
+	for _, pane := range panes {
+		c.events = append(c.events, network.PaneEvent{
+			Type:       eventType,
+			PaneID:     pane.ID,
+			WindowID:   pane.WindowID,
+			WindowName: pane.WindowName,
+			SessionID:  pane.SessionID,
+		})
+	}
+}
+
+// Collect captures every matched pane. With refresh set pane metadata and
+// window layouts are listed again, otherwise the last ones are reused.
+func (c *Collector) Collect(refresh bool) Sample {
+	// NOTE: One list-panes call refreshes command, title, size and position for every pane
+	if refresh || c.metadata == nil {
+		c.metadata = make(map[string]tmux.Pane)
+		if allPanes, err := c.backend.GetAllPanes(); err == nil {
+			for _, pane := range allPanes {
+				c.metadata[pane.ID] = pane
+			}
+		}
+		c.windows, _ = c.backend.GetAllWindows()
+
+		// NOTE: Without a fresh snapshot the previous usage is sent again, that beats none
+		if c.processes != nil {
+			c.processes.Refresh()
+		}
+	}
+
+	var sample Sample
+	seen := make(map[string]bool, len(c.panes))
+	for _, pane := range c.panes {
+		if latest, ok := c.metadata[pane.ID]; ok {
+			latest.Scrollback = pane.Scrollback
+			latest.Privacy = pane.Privacy
+			pane = latest
+		}
+
+		content, scrollback, err := c.capture(pane)
+		if err != nil {
+			// NOTE: The pane most likely closed, pick up the new layout before the next sample
+			c.rediscover = true
+			continue
+		}
+
+		var lastActivity int64
+		title, currentPath, usage := pane.Title, pane.CurrentPath, c.paneUsage(pane.PID)
+		if pane.Privacy == tmux.PrivacyMetadata {
+			seen[pane.ID] = true
+			lastActivity = c.trackActivity(pane.ID, content)
+			// NOTE: The working directory and child process names say as much about a pane as its content
+			content, scrollback, title, currentPath, usage = "", "", "", "", nil
+		} else {
+			// NOTE: Redact before capping so a key block isn't cut in half first, and across the scrollback and screen for the same reason
+			scrollback, content = c.redactor.RedactJoined(scrollback, content)
+			title = c.redactor.Redact(title)
+		}
+
+		sample.Panes = append(sample.Panes, network.TmuxPane{
+			ID:             pane.ID,
+			WindowID:       pane.WindowID,
+			WindowName:     pane.WindowName,
+			SessionID:      pane.SessionID,
+			SessionName:    pane.SessionName,
+			Content:        content,
+			Scrollback:     capScrollback(scrollback, c.scrollbackLimit),
+			Active:         pane.Active,
+			CurrentCommand: pane.CurrentCommand,
+			PID:            pane.PID,
+			CurrentPath:    currentPath,
+			Title:          title,
+			Width:          pane.Width,
+			Height:         pane.Height,
+			Left:           pane.Left,
+			Top:            pane.Top,
+			Dead:           pane.Dead,
+			Socket:         pane.Socket,
+			Privacy:        pane.Privacy,
+			LastActivity:   lastActivity,
+			Usage:          usage,
+		})
+	}
+	for id := range c.activity {
+		if !seen[id] {
+			delete(c.activity, id)
+		}
+	}
+
+	sample.Windows = c.collectWindows(sample.Panes)
+	sample.PaneEvents = c.events
+	c.events = nil
+
+	return sample
+}
+
+// capture reads a pane's screen and, if its rule asks for it, the
+// scrollback above it.
+func (c *Collector) capture(pane tmux.Pane) (string, string, error) {
+	if c.watcher != nil {
+		return c.watcher.Capture(pane)
+	}
+
+	content, err := c.backend.GetPaneContent(pane.SessionID, pane.WindowID, pane.ID)
+	if err != nil || pane.Scrollback <= 0 {
+		return content, "", err
+	}
+
+	// NOTE: Missing scrollback isn't worth dropping the pane over
+	scrollback, _ := c.backend.GetPaneScrollback(pane.SessionID, pane.WindowID, pane.ID, pane.Scrollback)
+	return content, scrollback, nil
+}
+
+// topChildren is how many of a pane's busiest processes are sent.
+const topChildren = 3
+
+// paneUsage adds up the process tree started by a pane, nil without a
+// process sampler or if the pane's process is gone.
+func (c *Collector) paneUsage(pid int) *network.PaneUsage {
+	if c.processes == nil || pid <= 0 {
+		return nil
+	}
+	tree, ok := c.processes.Tree(int32(pid), topChildren)
+	if !ok {
+		return nil
+	}
+
+	usage := &network.PaneUsage{
+		CPUPercent: tree.CPUPercent,
+		RSS:        tree.RSS,
+		Threads:    tree.Threads,
+		Processes:  tree.Processes,
+	}
+	for _, child := range tree.Top {
+		usage.Top = append(usage.Top, network.ProcessUsage{
+			PID:        child.PID,
+			Name:       child.Name,
+			CPUPercent: child.CPUPercent,
+			RSS:        child.RSS,
+		})
+	}
+	return usage
+}
+
+// trackActivity returns when the content of a metadata only pane last
+// changed. The first capture is the baseline, not activity.
+func (c *Collector) trackActivity(paneID, content string) int64 {
+	hash := crc32.ChecksumIEEE([]byte(content))
+
+	activity, known := c.activity[paneID]
+	if known && activity.hash != hash {
+		activity.last = time.Now().Unix()
+	}
+	activity.hash = hash
+	c.activity[paneID] = activity
+
+	return activity.last
+}
+
+// collectWindows returns layout and size of the windows panes belong to.
+func (c *Collector) collectWindows(panes []network.TmuxPane) []network.TmuxWindow {
+	monitored := make(map[string]bool)
+	for _, pane := range panes {
+		monitored[pane.WindowID] = true
+	}
+
+	var windows []network.TmuxWindow
+	for _, window := range c.windows {
+		if !monitored[window.ID] {
+			continue
+		}
+		windows = append(windows, network.TmuxWindow{
+			ID:        window.ID,
+			Index:     window.Index,
+			Name:      window.Name,
+			SessionID: window.SessionID,
+			Active:    window.Active,
+			Width:     window.Width,
+			Height:    window.Height,
+			Layout:    window.Layout,
+			Socket:    window.Socket,
+		})
+	}
+	return windows
+}
+
+// capScrollback keeps the newest lines of scrollback that fit in maxBytes.
+func capScrollback(scrollback string, maxBytes int) string {
+	if maxBytes <= 0 || len(scrollback) <= maxBytes {
+		return scrollback
+	}
+
+	scrollback = scrollback[len(scrollback)-maxBytes:]
+	if i := strings.IndexByte(scrollback, '\n'); i >= 0 {
+		scrollback = scrollback[i+1:]
+	}
+	return scrollback
+}
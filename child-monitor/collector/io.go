@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/net"
+)
+
+// NetStats is the traffic of one network interface since the previous
+// sample, per second.
+type NetStats struct {
+	Interface       string  `json:"interface"`
+	RxBytesPerSec   float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec   float64 `json:"tx_bytes_per_sec"`
+	RxPacketsPerSec float64 `json:"rx_packets_per_sec"`
+	TxPacketsPerSec float64 `json:"tx_packets_per_sec"`
+	RxErrorsPerSec  float64 `json:"rx_errors_per_sec"`
+	TxErrorsPerSec  float64 `json:"tx_errors_per_sec"`
+}
+
+// DiskIOStats is the throughput of one block device since the previous
+// sample. Utilization is the share of time the device was busy.
+type DiskIOStats struct {
+	Device             string  `json:"device"`
+	ReadBytesPerSec    float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec   float64 `json:"write_bytes_per_sec"`
+	ReadIOPS           float64 `json:"read_iops"`
+	WriteIOPS          float64 `json:"write_iops"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+type ioCounters struct {
+	at    time.Time
+	net   map[string]net.IOCountersStat
+	disks map[string]disk.IOCountersStat
+}
+
+// readIOCounters reads the counters of every interface and block device.
+// Either may be missing, e.g. in a container without /sys.
+func readIOCounters() ioCounters {
+	counters := ioCounters{
+		at:    time.Now(),
+		net:   make(map[string]net.IOCountersStat),
+		disks: make(map[string]disk.IOCountersStat),
+	}
+
+	if interfaces, err := net.IOCounters(true); err == nil {
+		for _, iface := range interfaces {
+			if iface.Name == "lo" {
+				continue
+			}
+			counters.net[iface.Name] = iface
+		}
+	}
+
+	if devices, err := disk.IOCounters(); err == nil {
+		for name, device := range devices {
+			if isBlockDevice(name) {
+				counters.disks[name] = device
+			}
+		}
+	}
+
+	return counters
+}
+
+// isBlockDevice reports whether name is a whole disk rather than a partition,
+// loop or RAM device, so nothing is counted twice.
+func isBlockDevice(name string) bool {
+	if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+		return false
+	}
+	if _, err := os.Stat("/sys/block"); err != nil {
+		return true
+	}
+	_, err := os.Stat(filepath.Join("/sys/block", name))
+	return err == nil
+}
+
+// ratesSince turns the growth of the counters since prev into rates.
+// Interfaces and devices that only just appeared are left out.
+func (c ioCounters) ratesSince(prev ioCounters) ([]NetStats, []DiskIOStats) {
+	elapsed := c.at.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return nil, nil
+	}
+	rate := func(prev, cur uint64) float64 {
+		// NOTE: Counters go backwards when a device is re-created, that sample is zero
+		if cur < prev {
+			return 0
+		}
+		return float64(cur-prev) / elapsed
+	}
+
+	var network []NetStats
+	for name, cur := range c.net {
+		old, ok := prev.net[name]
+		if !ok {
+			continue
+		}
+		network = append(network, NetStats{
+			Interface:       name,
+			RxBytesPerSec:   rate(old.BytesRecv, cur.BytesRecv),
+			TxBytesPerSec:   rate(old.BytesSent, cur.BytesSent),
+			RxPacketsPerSec: rate(old.PacketsRecv, cur.PacketsRecv),
+			TxPacketsPerSec: rate(old.PacketsSent, cur.PacketsSent),
+			RxErrorsPerSec:  rate(old.Errin, cur.Errin),
+			TxErrorsPerSec:  rate(old.Errout, cur.Errout),
+		})
+	}
+	sort.Slice(network, func(i, j int) bool {
+		return network[i].Interface < network[j].Interface
+	})
+
+	var diskIO []DiskIOStats
+	for name, cur := range c.disks {
+		old, ok := prev.disks[name]
+		if !ok {
+			continue
+		}
+		diskIO = append(diskIO, DiskIOStats{
+			Device:             name,
+			ReadBytesPerSec:    rate(old.ReadBytes, cur.ReadBytes),
+			WriteBytesPerSec:   rate(old.WriteBytes, cur.WriteBytes),
+			ReadIOPS:           rate(old.ReadCount, cur.ReadCount),
+			WriteIOPS:          rate(old.WriteCount, cur.WriteCount),
+			UtilizationPercent: min(100, rate(old.IoTime, cur.IoTime)/10),
+		})
+	}
+	sort.Slice(diskIO, func(i, j int) bool {
+		return diskIO[i].Device < diskIO[j].Device
+	})
+
+	return network, diskIO
+}
@@ -0,0 +1,186 @@
+package collector
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// MountFilter picks the filesystems reported besides /. Paths are globs on
+// the mount point that also match every mount below it, FSTypes filesystem
+// type names. With no includes every filesystem on a physical device is
+// reported.
+type MountFilter struct {
+	Paths          []string
+	ExcludePaths   []string
+	FSTypes        []string
+	ExcludeFSTypes []string
+}
+
+// defaultExcludeFSTypes are read-only images that are always full.
+var defaultExcludeFSTypes = []string{"squashfs", "iso9660"}
+
+// remoteFSTypes are network filesystems, only reported when FSTypes names
+// them: statfs on one whose server is gone can hang.
+var remoteFSTypes = []string{"nfs", "nfs4", "cifs", "smb3", "smbfs", "9p", "ceph", "glusterfs", "afs", "lustre", "gpfs", "fuse.sshfs", "fuse.glusterfs", "fuse.s3fs", "fuse.rclone"}
+
+// statfsTimeout bounds how long one mount may hold up a sample.
+const statfsTimeout = 2 * time.Second
+
+var (
+	// hungMounts are mount points whose statfs timed out and hasn't
+	// returned yet, so a stuck mount doesn't pile up goroutines.
+	hungMounts = make(map[string]bool)
+	hungMutex  sync.Mutex
+)
+
+// Validate checks the path globs.
+func (f MountFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Paths...), f.ExcludePaths...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid mount glob %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func (f MountFilter) matches(partition disk.PartitionStat) bool {
+	if len(f.Paths) > 0 && !matchPath(f.Paths, partition.Mountpoint) {
+		return false
+	}
+	if len(f.FSTypes) > 0 && !matchAny(f.FSTypes, partition.Fstype) {
+		return false
+	}
+	if matchPath(f.ExcludePaths, partition.Mountpoint) || matchAny(f.ExcludeFSTypes, partition.Fstype) {
+		return false
+	}
+	if matchAny(remoteFSTypes, partition.Fstype) && !matchAny(f.FSTypes, partition.Fstype) {
+		return false
+	}
+	return len(f.FSTypes) > 0 || !matchAny(defaultExcludeFSTypes, partition.Fstype)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether mountpoint or a directory above it matches.
+func matchPath(patterns []string, mountpoint string) bool {
+	for dir := mountpoint; ; dir = path.Dir(dir) {
+		if matchAny(patterns, dir) {
+			return true
+		}
+		if dir == "/" || dir == "." {
+			return false
+		}
+	}
+}
+
+// collectMounts returns usage of every mount the filter lets through, by
+// mount point. A device mounted more than once, e.g. with bind mounts, is
+// only reported at its first mount point.
+func collectMounts(filter MountFilter) ([]DiskStats, error) {
+	// NOTE: Virtual and network filesystems are only listed when asked for
+	all := len(filter.Paths) > 0 || len(filter.FSTypes) > 0
+	partitions, err := disk.Partitions(all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %w", err)
+	}
+
+	var mounts []DiskStats
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		if !filter.matches(partition) || seen[partition.Mountpoint] {
+			continue
+		}
+		if strings.HasPrefix(partition.Device, "/dev/") {
+			if seen[partition.Device] {
+				continue
+			}
+			seen[partition.Device] = true
+		}
+		seen[partition.Mountpoint] = true
+
+		usage, err := usageWithTimeout(partition.Mountpoint)
+		if err != nil || usage.Total == 0 {
+			continue
+		}
+		mounts = append(mounts, newDiskStats(partition, usage))
+	}
+
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Mountpoint < mounts[j].Mountpoint
+	})
+	return mounts, nil
+}
+
+// usageWithTimeout gives up on a mount after statfsTimeout. The statfs call
+// itself can't be cancelled and keeps running in the background.
+func usageWithTimeout(mountpoint string) (*disk.UsageStat, error) {
+	hungMutex.Lock()
+	hung := hungMounts[mountpoint]
+	hungMutex.Unlock()
+	if hung {
+		return nil, fmt.Errorf("statfs on %s is still hanging", mountpoint)
+	}
+
+	type result struct {
+		usage *disk.UsageStat
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		usage, err := disk.Usage(mountpoint)
+		done <- result{usage, err}
+
+		hungMutex.Lock()
+		delete(hungMounts, mountpoint)
+		hungMutex.Unlock()
+	}()
+
+	timer := time.NewTimer(statfsTimeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-done:
+		return r.usage, r.err
+	case <-timer.C:
+	}
+
+	hungMutex.Lock()
+	defer hungMutex.Unlock()
+	// NOTE: Checked under the lock, so a statfs returning right now can't clear the mark before it is set
+	select {
+	case r := <-done:
+		return r.usage, r.err
+	default:
+		hungMounts[mountpoint] = true
+		return nil, fmt.Errorf("statfs on %s timed out", mountpoint)
+	}
+}
+
+func newDiskStats(partition disk.PartitionStat, usage *disk.UsageStat) DiskStats {
+	return DiskStats{
+		Mountpoint:    partition.Mountpoint,
+		Device:        partition.Device,
+		FSType:        partition.Fstype,
+		Total:         usage.Total,
+		Free:          usage.Free,
+		Used:          usage.Used,
+		Percent:       usage.UsedPercent,
+		InodesTotal:   usage.InodesTotal,
+		InodesUsed:    usage.InodesUsed,
+		InodesFree:    usage.InodesFree,
+		InodesPercent: usage.InodesUsedPercent,
+	}
+}
@@ -0,0 +1,238 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+
+	"child-monitor/redact"
+)
+
+// ProcessSampler keeps a snapshot of every process on the host. CPU usage
+// is computed from the CPU time each process used since the previous one.
+type ProcessSampler struct {
+	at        time.Time
+	processes map[int32]*processInfo
+	children  map[int32][]int32
+}
+
+type processInfo struct {
+	pid        int32
+	ppid       int32
+	name       string
+	cpuTime    float64
+	cpuPercent float64
+	rss        uint64
+	threads    int32
+}
+
+// ProcessTree is the combined usage of a process and all its descendants.
+// RSS is summed, so memory shared between them is counted more than once.
+type ProcessTree struct {
+	CPUPercent float64
+	RSS        uint64
+	Threads    int
+	Processes  int
+	Top        []ProcessUsage
+}
+
+type ProcessUsage struct {
+	PID        int32
+	Name       string
+	CPUPercent float64
+	RSS        uint64
+}
+
+// ProcessDetails describes one process of a top list. Cmdline is cut at
+// maxCmdline bytes.
+type ProcessDetails struct {
+	PID        int32
+	User       string
+	Cmdline    string
+	CPUPercent float64
+	RSS        uint64
+	State      string
+}
+
+const maxCmdline = 256
+
+// NewProcessSampler takes a first snapshot, so CPU usage is known from the
+// next Refresh on.
+func NewProcessSampler() *ProcessSampler {
+	// NOTE: Every process read would otherwise re-read the boot time from /proc/stat
+	process.EnableBootTimeCache(true)
+
+	sampler := &ProcessSampler{}
+	sampler.Refresh()
+	return sampler
+}
+
+// Refresh replaces the snapshot. Processes that exit while it is taken are
+// skipped.
+func (s *ProcessSampler) Refresh() error {
+	pids, err := process.Pids()
+	if err != nil {
+		return fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(s.at).Seconds()
+	processes := make(map[int32]*processInfo, len(pids))
+	children := make(map[int32][]int32)
+
+	for _, pid := range pids {
+		p := &process.Process{Pid: pid}
+
+		ppid, err := p.Ppid()
+		if err != nil {
+			continue
+		}
+		times, err := p.Times()
+		if err != nil {
+			continue
+		}
+
+		info := &processInfo{
+			pid:     pid,
+			ppid:    ppid,
+			cpuTime: times.User + times.System,
+		}
+		info.name, _ = p.Name()
+		info.threads, _ = p.NumThreads()
+		if memInfo, err := p.MemoryInfo(); err == nil {
+			info.rss = memInfo.RSS
+		}
+
+		// NOTE: A PID that was reused since the last snapshot has a different parent or less CPU time
+		if prev, ok := s.processes[pid]; ok && elapsed > 0 && prev.ppid == ppid && info.cpuTime >= prev.cpuTime {
+			info.cpuPercent = (info.cpuTime - prev.cpuTime) / elapsed * 100
+		}
+
+		processes[pid] = info
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	s.at = now
+	s.processes = processes
+	s.children = children
+	return nil
+}
+
+// Tree returns the usage of pid and its descendants in the last snapshot,
+// with up to top descendants using the most CPU. ok is false if pid isn't
+// running.
+func (s *ProcessSampler) Tree(pid int32, top int) (ProcessTree, bool) {
+	root, ok := s.processes[pid]
+	if !ok {
+		return ProcessTree{}, false
+	}
+
+	var tree ProcessTree
+	var descendants []*processInfo
+	visited := make(map[int32]bool)
+	stack := []*processInfo{root}
+
+	for len(stack) > 0 {
+		info := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if visited[info.pid] {
+			continue
+		}
+		visited[info.pid] = true
+
+		tree.CPUPercent += info.cpuPercent
+		tree.RSS += info.rss
+		tree.Threads += int(info.threads)
+		tree.Processes++
+		if info != root {
+			descendants = append(descendants, info)
+		}
+
+		for _, child := range s.children[info.pid] {
+			if childInfo, ok := s.processes[child]; ok {
+				stack = append(stack, childInfo)
+			}
+		}
+	}
+
+	sort.Slice(descendants, func(i, j int) bool {
+		if descendants[i].cpuPercent != descendants[j].cpuPercent {
+			return descendants[i].cpuPercent > descendants[j].cpuPercent
+		}
+		return descendants[i].rss > descendants[j].rss
+	})
+	for _, info := range descendants[:min(top, len(descendants))] {
+		tree.Top = append(tree.Top, ProcessUsage{
+			PID:        info.pid,
+			Name:       info.name,
+			CPUPercent: info.cpuPercent,
+			RSS:        info.rss,
+		})
+	}
+
+	return tree, true
+}
+
+// Top returns up to n processes using the most CPU and the most memory in
+// the last snapshot. User, command line and state are only read for those;
+// command lines are redacted before they are cut.
+func (s *ProcessSampler) Top(n int, redactor *redact.Redactor) (byCPU, byMemory []ProcessDetails) {
+	all := make([]*processInfo, 0, len(s.processes))
+	for _, info := range s.processes {
+		all = append(all, info)
+	}
+
+	details := make(map[int32]ProcessDetails)
+	pick := func(key func(*processInfo) float64) []ProcessDetails {
+		sort.Slice(all, func(i, j int) bool {
+			if a, b := key(all[i]), key(all[j]); a != b {
+				return a > b
+			}
+			return all[i].pid < all[j].pid
+		})
+
+		var top []ProcessDetails
+		for _, info := range all[:min(n, len(all))] {
+			if _, ok := details[info.pid]; !ok {
+				details[info.pid] = describeProcess(info, redactor)
+			}
+			top = append(top, details[info.pid])
+		}
+		return top
+	}
+
+	byCPU = pick(func(info *processInfo) float64 { return info.cpuPercent })
+	byMemory = pick(func(info *processInfo) float64 { return float64(info.rss) })
+	return byCPU, byMemory
+}
+
+// describeProcess reads what a top list shows beyond the snapshot. Kernel
+// threads have no command line and show their name in brackets, like ps.
+func describeProcess(info *processInfo, redactor *redact.Redactor) ProcessDetails {
+	p := &process.Process{Pid: info.pid}
+
+	details := ProcessDetails{
+		PID:        info.pid,
+		CPUPercent: info.cpuPercent,
+		RSS:        info.rss,
+	}
+	details.User, _ = p.Username()
+	if status, err := p.Status(); err == nil && len(status) > 0 {
+		details.State = status[0]
+	}
+
+	cmdline, _ := p.Cmdline()
+	if cmdline == "" {
+		cmdline = "[" + info.name + "]"
+	}
+	cmdline = redactor.Redact(cmdline)
+	if len(cmdline) > maxCmdline {
+		cmdline = strings.ToValidUTF8(cmdline[:maxCmdline], "") + "…"
+	}
+	details.Cmdline = cmdline
+
+	return details
+}
@@ -2,18 +2,61 @@ package collector
 
 import (
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 )
 
 type SystemStats struct {
 	Timestamp time.Time `json:"timestamp"`
 	CPU       float64   `json:"cpu_percent"`
+	CPUCores  []float64 `json:"cpu_cores,omitempty"`
+	CPUTimes  CPUTimes  `json:"cpu_times"`
+	Load      LoadStats `json:"load"`
 	Memory    MemStats  `json:"memory"`
-	Disk      DiskStats `json:"disk"`
+	Swap      SwapStats `json:"swap"`
+	// Disk is the root filesystem, Disks every reported mount including it.
+	Disk      DiskStats   `json:"disk"`
+	Disks     []DiskStats `json:"disks,omitempty"`
+	Processes int         `json:"processes"`
+	Threads   int         `json:"threads"`
+	Uptime    uint64      `json:"uptime_seconds"`
+
+	Network []NetStats    `json:"network,omitempty"`
+	DiskIO  []DiskIOStats `json:"disk_io,omitempty"`
+}
+
+// CPUTimes splits CPU time since the previous sample by state, in percent
+// of all cores.
+type CPUTimes struct {
+	User    float64 `json:"user"`
+	System  float64 `json:"system"`
+	Nice    float64 `json:"nice"`
+	IOWait  float64 `json:"iowait"`
+	IRQ     float64 `json:"irq"`
+	SoftIRQ float64 `json:"softirq"`
+	Steal   float64 `json:"steal"`
+	Idle    float64 `json:"idle"`
+}
+
+type LoadStats struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+type SwapStats struct {
+	Total   uint64  `json:"total"`
+	Used    uint64  `json:"used"`
+	Free    uint64  `json:"free"`
+	Percent float64 `json:"percent"`
 }
 
 type MemStats struct {
@@ -23,64 +66,231 @@ type MemStats struct {
 	Percent   float64 `json:"percent"`
 }
 
+// DiskStats is the usage of one mounted filesystem.
 type DiskStats struct {
-	Total   uint64  `json:"total"`
-	Free    uint64  `json:"free"`
-	Used    uint64  `json:"used"`
-	Percent float64 `json:"percent"`
+	Mountpoint    string  `json:"mountpoint,omitempty"`
+	Device        string  `json:"device,omitempty"`
+	FSType        string  `json:"fstype,omitempty"`
+	Total         uint64  `json:"total"`
+	Free          uint64  `json:"free"`
+	Used          uint64  `json:"used"`
+	Percent       float64 `json:"percent"`
+	InodesTotal   uint64  `json:"inodes_total"`
+	InodesUsed    uint64  `json:"inodes_used"`
+	InodesFree    uint64  `json:"inodes_free"`
+	InodesPercent float64 `json:"inodes_percent"`
 }
 
-func CollectSystemStats() (SystemStats, error) {
-	cpuPercent, err := cpu.Percent(time.Second, false)
+// Sampler collects system stats without blocking. CPU usage and I/O rates
+// are computed from the counters read by the previous call.
+type Sampler struct {
+	mounts MountFilter
+	total  cpu.TimesStat
+	cores  []cpu.TimesStat
+	io     ioCounters
+}
+
+// NewSampler reads the counters once, so the first sample already has
+// something to compare against. mounts picks the filesystems reported.
+func NewSampler(mounts MountFilter) *Sampler {
+	sampler := &Sampler{mounts: mounts}
+	if total, err := cpu.Times(false); err == nil && len(total) > 0 {
+		sampler.total = total[0]
+	}
+	sampler.cores, _ = cpu.Times(true)
+	sampler.io = readIOCounters()
+	return sampler
+}
+
+func (s *Sampler) CollectSystemStats() (SystemStats, error) {
+	total, err := cpu.Times(false)
 	if err != nil {
 		return SystemStats{}, fmt.Errorf("failed to get CPU stats: %w", err)
 	}
+	if len(total) == 0 {
+		return SystemStats{}, fmt.Errorf("failed to get CPU stats: no CPU times reported")
+	}
+	cpuTimes := cpuTimesSince(s.total, total[0])
+	s.total = total[0]
+
+	// NOTE: Per core counters are nice to have, a failure doesn't fail the sample
+	var cpuCores []float64
+	if cores, err := cpu.Times(true); err == nil {
+		if len(cores) == len(s.cores) {
+			cpuCores = make([]float64, len(cores))
+			for i := range cores {
+				cpuCores[i] = cpuTimesSince(s.cores[i], cores[i]).busy()
+			}
+		}
+		s.cores = cores
+	}
+
+	loadAvg, err := load.Avg()
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to get load average: %w", err)
+	}
 
 	memInfo, err := mem.VirtualMemory()
 	if err != nil {
 		return SystemStats{}, fmt.Errorf("failed to get memory stats: %w", err)
 	}
 
+	swapInfo, err := mem.SwapMemory()
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to get swap stats: %w", err)
+	}
+
 	diskInfo, err := disk.Usage("/")
 	if err != nil {
 		return SystemStats{}, fmt.Errorf("failed to get disk stats: %w", err)
 	}
 
+	// NOTE: The root filesystem is always reported, other mounts are best effort
+	disks, _ := collectMounts(s.mounts)
+
+	misc, err := load.Misc()
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to count processes: %w", err)
+	}
+
+	uptime, err := host.Uptime()
+	if err != nil {
+		return SystemStats{}, fmt.Errorf("failed to get uptime: %w", err)
+	}
+
+	io := readIOCounters()
+	network, diskIO := io.ratesSince(s.io)
+	s.io = io
+
 	return SystemStats{
 		Timestamp: time.Now(),
-		CPU:       cpuPercent[0],
+		CPU:       cpuTimes.busy(),
+		CPUCores:  cpuCores,
+		CPUTimes:  cpuTimes,
+		Load: LoadStats{
+			Load1:  loadAvg.Load1,
+			Load5:  loadAvg.Load5,
+			Load15: loadAvg.Load15,
+		},
 		Memory: MemStats{
 			Total:     memInfo.Total,
 			Available: memInfo.Available,
 			Used:      memInfo.Used,
 			Percent:   memInfo.UsedPercent,
 		},
-		Disk: DiskStats{
-			Total:   diskInfo.Total,
-			Free:    diskInfo.Free,
-			Used:    diskInfo.Used,
-			Percent: diskInfo.UsedPercent,
+		Swap: SwapStats{
+			Total:   swapInfo.Total,
+			Used:    swapInfo.Used,
+			Free:    swapInfo.Free,
+			Percent: swapInfo.UsedPercent,
 		},
+		Disk:      newDiskStats(disk.PartitionStat{Mountpoint: "/", Fstype: diskInfo.Fstype}, diskInfo),
+		Disks:     disks,
+		Processes: misc.ProcsTotal,
+		Threads:   countThreads(),
+		Uptime:    uptime,
+		Network:   network,
+		DiskIO:    diskIO,
 	}, nil
 }
 
+// cpuTimesSince turns the growth of CPU time counters into percentages.
+// Guest time is already part of user time on Linux and isn't added again.
+func cpuTimesSince(prev, cur cpu.TimesStat) CPUTimes {
+	delta := CPUTimes{
+		User:    cur.User - prev.User,
+		System:  cur.System - prev.System,
+		Nice:    cur.Nice - prev.Nice,
+		IOWait:  cur.Iowait - prev.Iowait,
+		IRQ:     cur.Irq - prev.Irq,
+		SoftIRQ: cur.Softirq - prev.Softirq,
+		Steal:   cur.Steal - prev.Steal,
+		Idle:    cur.Idle - prev.Idle,
+	}
+
+	total := delta.User + delta.System + delta.Nice + delta.IOWait + delta.IRQ + delta.SoftIRQ + delta.Steal + delta.Idle
+	if total <= 0 {
+		return CPUTimes{Idle: 100}
+	}
+
+	percent := func(v float64) float64 {
+		return max(0, v/total*100)
+	}
+	return CPUTimes{
+		User:    percent(delta.User),
+		System:  percent(delta.System),
+		Nice:    percent(delta.Nice),
+		IOWait:  percent(delta.IOWait),
+		IRQ:     percent(delta.IRQ),
+		SoftIRQ: percent(delta.SoftIRQ),
+		Steal:   percent(delta.Steal),
+		Idle:    percent(delta.Idle),
+	}
+}
+
+// busy is the share of time spent neither idle nor waiting on I/O, the
+// same as cpu.Percent reports.
+func (t CPUTimes) busy() float64 {
+	return max(0, 100-t.Idle-t.IOWait)
+}
+
+// countThreads reads the number of threads on the host from /proc/loadavg,
+// zero where that isn't available.
+func countThreads() int {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return 0
+	}
+	_, total, _ := strings.Cut(fields[3], "/")
+	threads, _ := strconv.Atoi(total)
+	return threads
+}
+
 func FormatSystemStats(stats SystemStats) string {
 	return fmt.Sprintf(
 		"System Stats [%s]\n"+
-			"CPU: %.1f%%\n"+
+			"CPU: %.1f%% (iowait %.1f%%, steal %.1f%%)\n"+
+			"Load: %.2f %.2f %.2f\n"+
 			"Memory: %.1f%% (%s/%s)\n"+
-			"Disk: %.1f%% (%s/%s)\n",
+			"Swap: %.1f%% (%s/%s)\n"+
+			"Disk: %.1f%% (%s/%s)\n"+
+			"%s",
 		stats.Timestamp.Format("15:04:05"),
 		stats.CPU,
+		stats.CPUTimes.IOWait,
+		stats.CPUTimes.Steal,
+		stats.Load.Load1,
+		stats.Load.Load5,
+		stats.Load.Load15,
 		stats.Memory.Percent,
 		formatBytes(stats.Memory.Used),
 		formatBytes(stats.Memory.Total),
+		stats.Swap.Percent,
+		formatBytes(stats.Swap.Used),
+		formatBytes(stats.Swap.Total),
 		stats.Disk.Percent,
 		formatBytes(stats.Disk.Used),
 		formatBytes(stats.Disk.Total),
+		formatMounts(stats.Disks),
 	)
 }
 
+func formatMounts(disks []DiskStats) string {
+	var b strings.Builder
+	for _, d := range disks {
+		if d.Mountpoint == "/" {
+			continue
+		}
+		fmt.Fprintf(&b, "  %s: %.1f%% (%s/%s), inodes %.1f%%\n", d.Mountpoint, d.Percent, formatBytes(d.Used), formatBytes(d.Total), d.InodesPercent)
+	}
+	return b.String()
+}
+
 func formatBytes(bytes uint64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -5,6 +5,13 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"child-monitor/collector"
+	"child-monitor/redact"
+	"child-monitor/tmux"
 )
 
 type Config struct {
@@ -15,11 +22,194 @@ type Config struct {
 	WindowIDs       []string `json:"window_ids"`
 	PaneIDs         []string `json:"pane_ids"`
 	SessionName     string   `json:"session_name"`
+	AuthToken       string   `json:"auth_token,omitempty"`
+	SpoolMaxMB      int      `json:"spool_max_mb,omitempty"`
+	SpoolMaxAgeMins int      `json:"spool_max_age_minutes,omitempty"`
+	TLSCAFile       string   `json:"tls_ca_file,omitempty"`
+	TLSCertFile     string   `json:"tls_cert_file,omitempty"`
+	TLSKeyFile      string   `json:"tls_key_file,omitempty"`
+	TLSServerName   string   `json:"tls_server_name,omitempty"`
+
+	// Rules replace the fixed session/window/pane IDs above, which are
+	// only read from older configs.
+	Rules                 []tmux.Rule `json:"rules,omitempty"`
+	Sockets               []string    `json:"sockets,omitempty"`
+	DiscoveryIntervalSecs int         `json:"discovery_interval_seconds,omitempty"`
+	ScrollbackMaxBytes    int         `json:"scrollback_max_bytes,omitempty"`
+
+	// Backend picks how panes are read, see BackendExec and BackendControl.
+	Backend           string `json:"backend,omitempty"`
+	ControlCoalesceMs int    `json:"control_coalesce_ms,omitempty"`
+
+	// Secrets in pane content are redacted before they leave the host,
+	// RedactPatterns are regexes on top of the built-in detectors.
+	RedactPatterns []string `json:"redact_patterns,omitempty"`
+	RedactDisabled bool     `json:"redact_disabled,omitempty"`
+
+	// Filesystems reported besides /, globs on the mount point and
+	// filesystem type. Without includes every physical filesystem is.
+	MountInclude  []string `json:"mount_include,omitempty"`
+	MountExclude  []string `json:"mount_exclude,omitempty"`
+	FSTypeInclude []string `json:"fstype_include,omitempty"`
+	FSTypeExclude []string `json:"fstype_exclude,omitempty"`
+
+	// TopProcesses is how many of the busiest processes by CPU and by
+	// memory are sent every TopProcessesIntervalSecs, zero for none.
+	TopProcesses             int `json:"top_processes,omitempty"`
+	TopProcessesIntervalSecs int `json:"top_processes_interval_seconds,omitempty"`
+
+	// Reconnect tuning, zero means the sender default.
+	DialTimeoutSecs   int     `json:"dial_timeout_seconds,omitempty"`
+	WriteTimeoutSecs  int     `json:"write_timeout_seconds,omitempty"`
+	KeepAliveSecs     int     `json:"keepalive_seconds,omitempty"`
+	BackoffInitialMs  int     `json:"backoff_initial_ms,omitempty"`
+	BackoffMaxSecs    int     `json:"backoff_max_seconds,omitempty"`
+	BackoffMultiplier float64 `json:"backoff_multiplier,omitempty"`
+	BackoffJitter     float64 `json:"backoff_jitter,omitempty"`
+}
+
+// TLSEnabled reports whether the agent should dial the central over TLS.
+func (c Config) TLSEnabled() bool {
+	return c.TLSCAFile != "" || c.TLSCertFile != ""
+}
+
+// SelectionRules returns the pane selection rules. Configs written before
+// rules existed are converted to one rule per saved window.
+func (c Config) SelectionRules() []tmux.Rule {
+	if len(c.Rules) > 0 {
+		return c.Rules
+	}
+
+	session := c.SessionName
+	if session == "" {
+		session = c.SessionID
+	}
+	if session == "" {
+		return nil
+	}
+
+	// NOTE: Saved pane IDs are dropped, they don't survive a tmux restart
+	if len(c.WindowIDs) == 0 {
+		return []tmux.Rule{{Session: session, Panes: tmux.PanesAll}}
+	}
+
+	rules := make([]tmux.Rule, 0, len(c.WindowIDs))
+	for _, windowID := range c.WindowIDs {
+		rules = append(rules, tmux.Rule{Session: session, Window: tmux.EscapeGlob(windowID), Panes: tmux.PanesAll})
+	}
+	return rules
+}
+
+// TmuxSockets returns the tmux sockets to watch: the configured ones, or
+// else every socket a rule names.
+func (c Config) TmuxSockets() []string {
+	if len(c.Sockets) > 0 {
+		return c.Sockets
+	}
+
+	var sockets []string
+	seen := make(map[string]bool)
+	for _, rule := range c.SelectionRules() {
+		socket := tmux.NormalizeSocket(rule.Socket)
+		if socket == "" {
+			socket = tmux.DefaultSocket
+		}
+		if !seen[socket] {
+			seen[socket] = true
+			sockets = append(sockets, socket)
+		}
+	}
+	return sockets
+}
+
+// DiscoveryInterval is how often the selection rules are re-resolved.
+func (c Config) DiscoveryInterval() time.Duration {
+	if c.DiscoveryIntervalSecs <= 0 {
+		return defaultDiscoveryInterval
+	}
+	return time.Duration(c.DiscoveryIntervalSecs) * time.Second
+}
+
+// ScrollbackLimit is the most scrollback sent per pane, the oldest lines
+// are dropped beyond it.
+func (c Config) ScrollbackLimit() int {
+	if c.ScrollbackMaxBytes <= 0 {
+		return defaultScrollbackMaxBytes
+	}
+	return c.ScrollbackMaxBytes
+}
+
+// ControlCoalesce is how long the control backend collects output before
+// sending a sample.
+func (c Config) ControlCoalesce() time.Duration {
+	if c.ControlCoalesceMs <= 0 {
+		return defaultControlCoalesce
+	}
+	return time.Duration(c.ControlCoalesceMs) * time.Millisecond
+}
+
+// Redactor returns the redaction stage for pane content, or nil if
+// redaction is turned off.
+func (c Config) Redactor() (*redact.Redactor, error) {
+	if c.RedactDisabled {
+		return nil, nil
+	}
+	return redact.New(c.RedactPatterns)
+}
+
+// TopProcessesInterval is how often the top process lists are sent.
+func (c Config) TopProcessesInterval() time.Duration {
+	if c.TopProcessesIntervalSecs <= 0 {
+		return defaultTopProcessesInterval
+	}
+	return time.Duration(c.TopProcessesIntervalSecs) * time.Second
+}
+
+// MountFilter picks the filesystems whose usage is reported.
+func (c Config) MountFilter() collector.MountFilter {
+	return collector.MountFilter{
+		Paths:          c.MountInclude,
+		ExcludePaths:   c.MountExclude,
+		FSTypes:        c.FSTypeInclude,
+		ExcludeFSTypes: c.FSTypeExclude,
+	}
+}
+
+// SpoolLimits returns the spool size and age limits, applying defaults.
+func (c Config) SpoolLimits() (int64, time.Duration) {
+	maxMB := c.SpoolMaxMB
+	if maxMB <= 0 {
+		maxMB = defaultSpoolMaxMB
+	}
+
+	maxAgeMins := c.SpoolMaxAgeMins
+	if maxAgeMins <= 0 {
+		maxAgeMins = defaultSpoolMaxAgeMins
+	}
+
+	return int64(maxMB) * 1024 * 1024, time.Duration(maxAgeMins) * time.Minute
 }
 
+// BackendExec polls every pane with capture-pane each sample. BackendControl
+// attaches to the sessions in tmux control mode and samples on output.
+const (
+	BackendExec    = "exec"
+	BackendControl = "control"
+)
+
 const (
 	configDirName  = "server-management"
 	configFileName = "monitor_config.json"
+	spoolDirName   = "spool"
+
+	defaultSpoolMaxMB      = 100
+	defaultSpoolMaxAgeMins = 24 * 60
+
+	defaultDiscoveryInterval  = 10 * time.Second
+	defaultScrollbackMaxBytes = 256 * 1024
+	defaultControlCoalesce    = 250 * time.Millisecond
+
+	defaultTopProcessesInterval = 10 * time.Second
 )
 
 func getConfigDir() (string, error) {
@@ -52,7 +242,11 @@ func ensureConfigDir() error {
 		return err
 	}
 
-	return os.MkdirAll(configDir, 0755)
+	// NOTE: The config holds the agent token, MkdirAll leaves the mode of an existing directory alone
+	if err := os.MkdirAll(configDir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(configDir, 0700)
 }
 
 func SaveConfig(config Config) error {
@@ -70,9 +264,12 @@ func SaveConfig(config Config) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := os.WriteFile(configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	if err := os.Chmod(configPath, 0600); err != nil {
+		return fmt.Errorf("failed to restrict config file: %w", err)
+	}
 
 	return nil
 }
@@ -83,6 +280,12 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	return LoadConfigFile(configPath)
+}
+
+// LoadConfigFile reads a config from an explicit path, e.g. one mounted
+// into a container.
+func LoadConfigFile(configPath string) (*Config, error) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("config file not found")
 	}
@@ -100,6 +303,66 @@ func LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
+// Validate checks the fields the agent needs before it can start.
+func (c Config) Validate() error {
+	if strings.TrimSpace(c.ServerName) == "" {
+		return fmt.Errorf("server name is required")
+	}
+	if c.CentralServerIP == "" {
+		return fmt.Errorf("central server address is required")
+	}
+
+	port, err := strconv.Atoi(c.CentralPort)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid central port %q", c.CentralPort)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("tls_cert_file and tls_key_file must be set together")
+	}
+	if c.SpoolMaxMB < 0 || c.SpoolMaxAgeMins < 0 {
+		return fmt.Errorf("spool limits must not be negative")
+	}
+	if c.TopProcesses < 0 || c.TopProcessesIntervalSecs < 0 {
+		return fmt.Errorf("top_processes and its interval must not be negative")
+	}
+	if c.BackoffJitter < 0 || c.BackoffJitter > 1 {
+		return fmt.Errorf("backoff_jitter must be between 0 and 1")
+	}
+
+	switch c.Backend {
+	case "", BackendExec, BackendControl:
+	default:
+		return fmt.Errorf("invalid backend %q, expected %q or %q", c.Backend, BackendExec, BackendControl)
+	}
+
+	if _, err := c.Redactor(); err != nil {
+		return err
+	}
+	if err := c.MountFilter().Validate(); err != nil {
+		return err
+	}
+
+	rules := c.SelectionRules()
+	if len(rules) == 0 {
+		return fmt.Errorf("no tmux session or selection rules configured")
+	}
+	sockets := make(map[string]bool)
+	for _, socket := range c.TmuxSockets() {
+		sockets[tmux.NormalizeSocket(socket)] = true
+	}
+	for i, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if !sockets[tmux.NormalizeSocket(rule.Socket)] {
+			return fmt.Errorf("rule %d: socket %q is not in sockets", i+1, rule.Socket)
+		}
+	}
+
+	return nil
+}
+
 func ConfigExists() bool {
 	configPath, err := getConfigFilePath()
 	if err != nil {
@@ -126,3 +389,15 @@ func DeleteConfig() error {
 func GetConfigPath() (string, error) {
 	return getConfigFilePath()
 }
+
+// GetSpoolDir returns where unsent samples for serverName are kept.
+func GetSpoolDir(serverName string) (string, error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	safeServerName := strings.ReplaceAll(serverName, "/", "_")
+	safeServerName = strings.ReplaceAll(safeServerName, "\\", "_")
+	return filepath.Join(configDir, spoolDirName, safeServerName), nil
+}
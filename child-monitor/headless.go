@@ -0,0 +1,248 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"child-monitor/config"
+	"child-monitor/network"
+	"child-monitor/tmux"
+)
+
+// Exit codes, so supervisors can tell a bad config from a crash.
+const (
+	exitOK       = 0
+	exitFailure  = 1
+	exitUsage    = 2
+	exitTmux     = 3
+	exitRejected = 4
+)
+
+type options struct {
+	tui         bool
+	showVersion bool
+	configPath  string
+	serverName  string
+	central     string
+	token       string
+	session     string
+	windows     string
+	windowRegex string
+	panes       string
+	scrollback  int
+	backend     string
+	sockets     string
+}
+
+// parseFlags reads the command line. Every flag falls back to a MONITOR_*
+// environment variable, and anything left empty comes from the config file.
+func parseFlags() options {
+	var opts options
+
+	flag.BoolVar(&opts.tui, "tui", envBool("MONITOR_TUI"), "run the interactive setup and pane pickers")
+	flag.BoolVar(&opts.showVersion, "version", false, "print the agent version and exit")
+	flag.StringVar(&opts.configPath, "config", os.Getenv("MONITOR_CONFIG"), "config file to use instead of the default location")
+	flag.StringVar(&opts.serverName, "server-name", os.Getenv("MONITOR_SERVER_NAME"), "name this server reports as")
+	flag.StringVar(&opts.central, "central", os.Getenv("MONITOR_CENTRAL"), "central server address as host:port")
+	flag.StringVar(&opts.token, "token", os.Getenv("MONITOR_AUTH_TOKEN"), "agent token for the central server")
+	flag.StringVar(&opts.session, "session", os.Getenv("MONITOR_SESSION"), "comma separated tmux sessions to monitor, by name or ID, as socket:session for other sockets")
+	flag.StringVar(&opts.windows, "windows", os.Getenv("MONITOR_WINDOWS"), "comma separated globs on window names or IDs (default all)")
+	flag.StringVar(&opts.windowRegex, "window-regex", os.Getenv("MONITOR_WINDOW_REGEX"), "regular expression on window names")
+	flag.StringVar(&opts.panes, "panes", os.Getenv("MONITOR_PANES"), "\"all\" panes or only the \"active\" pane of each window")
+	flag.IntVar(&opts.scrollback, "scrollback", envInt("MONITOR_SCROLLBACK"), "lines of scrollback to capture above the visible screen")
+	flag.StringVar(&opts.backend, "backend", os.Getenv("MONITOR_BACKEND"), "\"exec\" to poll panes or \"control\" to follow tmux control mode")
+	flag.StringVar(&opts.sockets, "sockets", os.Getenv("MONITOR_SOCKETS"), "comma separated tmux socket names or paths (default: those the rules use)")
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		exitWith(exitUsage, "unexpected arguments: %s", strings.Join(flag.Args(), " "))
+	}
+
+	return opts
+}
+
+// envBool and envInt exit with exitUsage on a value they can't parse, an
+// unset variable is false or zero.
+func envBool(name string) bool {
+	value := strings.ToLower(os.Getenv(name))
+	switch value {
+	case "", "no":
+		return false
+	case "yes":
+		return true
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		exitWith(exitUsage, "invalid %s %q, expected true or false", name, os.Getenv(name))
+	}
+	return parsed
+}
+
+func envInt(name string) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		exitWith(exitUsage, "invalid %s %q, expected a whole number", name, value)
+	}
+	return parsed
+}
+
+func exitWith(code int, format string, args ...any) {
+	fmt.Fprintf(os.Stderr, errorStyle.Render(" "+format)+"\n", args...)
+	os.Exit(code)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadHeadlessConfig merges the config file with flags and env vars.
+func loadHeadlessConfig(opts options) (*config.Config, error) {
+	cfg := &config.Config{}
+
+	switch {
+	case opts.configPath != "":
+		loaded, err := config.LoadConfigFile(opts.configPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.configPath, err)
+		}
+		cfg = loaded
+	case config.ConfigExists():
+		loaded, err := config.LoadConfig()
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	if opts.serverName != "" {
+		cfg.ServerName = opts.serverName
+	}
+	if opts.central != "" {
+		host, port, err := net.SplitHostPort(opts.central)
+		if err != nil {
+			return nil, fmt.Errorf("invalid central address %q: %w", opts.central, err)
+		}
+		cfg.CentralServerIP, cfg.CentralPort = host, port
+	}
+	if opts.token != "" {
+		cfg.AuthToken = opts.token
+	}
+	if opts.backend != "" {
+		cfg.Backend = opts.backend
+	}
+	if opts.sockets != "" {
+		cfg.Sockets = splitList(opts.sockets)
+	}
+	if opts.session != "" || opts.windows != "" || opts.windowRegex != "" || opts.panes != "" || opts.scrollback != 0 {
+		cfg.Rules = rulesFromFlags(opts, cfg.SelectionRules())
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// rulesFromFlags builds one rule per -session and -windows glob pair. A
+// session may be prefixed with its socket, tmux never has ":" in session
+// names. Settings not given on the command line are taken from the first
+// configured rule.
+func rulesFromFlags(opts options, configured []tmux.Rule) []tmux.Rule {
+	var base tmux.Rule
+	if len(configured) > 0 {
+		base = configured[0]
+	}
+
+	if opts.windowRegex != "" {
+		base.WindowRegex = opts.windowRegex
+	}
+	if opts.panes != "" {
+		base.Panes = opts.panes
+	}
+	if opts.scrollback != 0 {
+		base.Scrollback = opts.scrollback
+	}
+
+	sessions := splitList(opts.session)
+	if len(sessions) == 0 {
+		sessions = []string{base.Session}
+	}
+
+	globs := splitList(opts.windows)
+	if len(globs) == 0 {
+		globs = []string{base.Window}
+	}
+
+	var rules []tmux.Rule
+	for _, session := range sessions {
+		for _, glob := range globs {
+			rule := base
+			rule.Session = session
+			if socket, name, found := strings.Cut(session, ":"); found {
+				rule.Socket, rule.Session = socket, name
+			}
+			rule.Window = glob
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// runHeadless starts collecting without any prompts, for systemd and
+// containers. Invalid input exits straight away with a distinct code.
+func runHeadless(opts options) {
+	cfg, err := loadHeadlessConfig(opts)
+	if err != nil {
+		exitWith(exitUsage, "Invalid configuration: %v", err)
+	}
+
+	backend := tmux.NewExecBackend(cfg.TmuxSockets()...)
+
+	if !backend.IsRunning() {
+		exitWith(exitTmux, "Tmux is not running or not installed")
+	}
+
+	resolver, err := tmux.NewResolver(backend, cfg.SelectionRules())
+	if err != nil {
+		exitWith(exitUsage, "Invalid selection rules: %v", err)
+	}
+
+	fmt.Printf(successStyle.Render(" Server: %s")+"\n", cfg.ServerName)
+	fmt.Printf(successStyle.Render(" Central: %s:%s")+"\n", cfg.CentralServerIP, cfg.CentralPort)
+	for _, rule := range cfg.SelectionRules() {
+		fmt.Printf(infoStyle.Render(" Rule: %s")+"\n", describeRule(rule))
+	}
+
+	sender, err := newSender(cfg)
+	if err != nil {
+		exitWith(exitUsage, "%v", err)
+	}
+
+	// NOTE: An unreachable central is not fatal, the sender keeps retrying and spools meanwhile
+	if err := sender.TestConnection(); errors.Is(err, network.ErrRejected) {
+		exitWith(exitRejected, "%v", err)
+	} else if err != nil {
+		fmt.Printf(warningStyle.Render(" Central not reachable yet: %v")+"\n", err)
+	}
+
+	handleShutdown(sender)
+	runDataCollection(cfg, backend, resolver, sender)
+}
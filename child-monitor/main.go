@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -13,10 +14,12 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"child-monitor/agent"
 	"child-monitor/collector"
 	"child-monitor/config"
 	"child-monitor/logger"
 	"child-monitor/network"
+	"child-monitor/spool"
 	"child-monitor/tmux"
 	"child-monitor/ui"
 )
@@ -45,12 +48,31 @@ var (
 )
 
 func main() {
+	opts := parseFlags()
+	if opts.showVersion {
+		fmt.Println(version)
+		return
+	}
+
 	fmt.Println(successStyle.Render("Tmux Monitor Data Collector"))
 	fmt.Println("====================================")
 
-	if !tmux.IsTmuxRunning() {
+	if !opts.tui {
+		runHeadless(opts)
+		return
+	}
+
+	runInteractive(splitList(opts.sockets))
+}
+
+// runInteractive walks through setup and the session, window and pane
+// pickers. Only used with -tui. Sessions are listed from sockets, or the
+// sockets in an existing config.
+func runInteractive(sockets []string) {
+	backend := tmux.NewExecBackend(sockets...)
+	if !backend.IsRunning() {
 		fmt.Println(errorStyle.Render(" Tmux is not running or not installed"))
-		os.Exit(1)
+		os.Exit(exitTmux)
 	}
 
 	fmt.Println(successStyle.Render(" Tmux detected"))
@@ -63,12 +85,12 @@ func main() {
 
 		cfg, err = config.LoadConfig()
 		if err != nil {
-			fmt.Printf(errorStyle.Render(" Failed to load config: %v\n"), err)
+			fmt.Printf(errorStyle.Render(" Failed to load config: %v")+"\n", err)
 			fmt.Println(infoStyle.Render(" Starting fresh setup..."))
 			cfg = runSetupFlow()
 		} else {
 			configPath, _ := config.GetConfigPath()
-			fmt.Printf(infoStyle.Render(" Config location: %s\n"), configPath)
+			fmt.Printf(infoStyle.Render(" Config location: %s")+"\n", configPath)
 			fmt.Println()
 
 			showExistingConfig(cfg)
@@ -78,7 +100,7 @@ func main() {
 			} else {
 				fmt.Println(warningStyle.Render(" Starting fresh setup..."))
 				if err := config.DeleteConfig(); err != nil {
-					fmt.Printf(errorStyle.Render(" Failed to delete old config: %v\n"), err)
+					fmt.Printf(errorStyle.Render(" Failed to delete old config: %v")+"\n", err)
 				} else {
 					fmt.Println(infoStyle.Render(" Old configuration deleted"))
 				}
@@ -90,69 +112,190 @@ func main() {
 		cfg = runSetupFlow()
 	}
 
-	fmt.Printf(successStyle.Render(" Server: %s\n"), cfg.ServerName)
-	fmt.Printf(successStyle.Render(" Central: %s:%s\n"), cfg.CentralServerIP, cfg.CentralPort)
+	fmt.Printf(successStyle.Render(" Server: %s")+"\n", cfg.ServerName)
+	fmt.Printf(successStyle.Render(" Central: %s:%s")+"\n", cfg.CentralServerIP, cfg.CentralPort)
+
+	if len(sockets) > 0 {
+		cfg.Sockets = sockets
+	}
+	if len(cfg.Sockets) > 0 {
+		backend = tmux.NewExecBackend(cfg.Sockets...)
+	}
+
+	sender, err := newSender(cfg)
+	if err != nil {
+		fmt.Printf(errorStyle.Render(" %v")+"\n", err)
+		os.Exit(exitUsage)
+	}
 
-	sender := network.NewDataSender(cfg.CentralServerIP, cfg.CentralPort)
 	fmt.Print(infoStyle.Render(" Testing connection... "))
 
 	if err := sender.TestConnection(); err != nil {
 		fmt.Println(errorStyle.Render(" Failed"))
-		fmt.Printf(errorStyle.Render("Error: %v\n"), err)
-		os.Exit(1)
+		fmt.Printf(errorStyle.Render("Error: %v")+"\n", err)
+		if errors.Is(err, network.ErrRejected) {
+			os.Exit(exitRejected)
+		}
+		os.Exit(exitFailure)
 	}
 	fmt.Println(successStyle.Render(" Connected"))
 
-	sessions, err := tmux.GetSessions()
+	sessions, err := backend.GetSessions()
 	if err != nil {
 		log.Fatalf("Failed to get tmux sessions: %v", err)
 	}
 
 	if len(sessions) == 0 {
 		fmt.Println(errorStyle.Render(" No tmux sessions found"))
-		os.Exit(1)
+		os.Exit(exitTmux)
 	}
 
-	fmt.Printf(infoStyle.Render(" Found %d tmux sessions\n"), len(sessions))
+	fmt.Printf(infoStyle.Render(" Found %d tmux sessions")+"\n", len(sessions))
 
-	selectedSession, selectedWindows, selectedPanes := runSelectionFlow(sessions)
+	cfg.SessionID, cfg.SessionName = "", ""
+	cfg.WindowIDs, cfg.PaneIDs = nil, nil
+	cfg.Rules = nil
 
-	cfg.SessionID = selectedSession.ID
-	cfg.SessionName = selectedSession.Name
+	for {
+		selectedSession, selectedWindows, selectedPanes := runSelectionFlow(backend, sessions)
+		cfg.Rules = append(cfg.Rules, rulesFromSelection(backend, selectedSession, selectedWindows, selectedPanes)...)
 
-	for _, window := range selectedWindows {
-		cfg.WindowIDs = append(cfg.WindowIDs, window.ID)
-	}
+		fmt.Printf("Selected session: %s\n", selectedSession.Name)
+		fmt.Printf("Selected windows: %d\n", len(selectedWindows))
+		fmt.Printf("Selected panes: %d\n", len(selectedPanes))
 
-	for _, pane := range selectedPanes {
-		cfg.PaneIDs = append(cfg.PaneIDs, pane.ID)
+		if len(sessions) == 1 || !confirm(" Monitor another session as well? [y/N]: ", false) {
+			break
+		}
 	}
 
 	if err := config.SaveConfig(*cfg); err != nil {
-		fmt.Printf(errorStyle.Render(" Failed to save config: %v\n"), err)
+		fmt.Printf(errorStyle.Render(" Failed to save config: %v")+"\n", err)
 	}
 
-	fmt.Printf(successStyle.Render(" Configuration saved!\n"))
-	fmt.Printf("Selected session: %s\n", selectedSession.Name)
-	fmt.Printf("Selected windows: %d\n", len(selectedWindows))
-	fmt.Printf("Selected panes: %d\n", len(selectedPanes))
+	fmt.Printf(successStyle.Render(" Configuration saved!") + "\n")
 	fmt.Println()
 
 	fmt.Println(infoStyle.Render(" Starting data collection and TCP sending..."))
 	fmt.Println("Press Ctrl+C to stop")
 	fmt.Println()
 
+	resolver, err := tmux.NewResolver(backend, cfg.SelectionRules())
+	if err != nil {
+		fmt.Printf(errorStyle.Render(" %v")+"\n", err)
+		os.Exit(exitUsage)
+	}
+
+	handleShutdown(sender)
+	runDataCollection(cfg, backend, resolver, sender)
+}
+
+// rulesFromSelection turns what was picked in the TUI into rules that keep
+// matching after panes are split or the session is restarted. A window
+// where only the active pane was picked follows whichever pane is active.
+func rulesFromSelection(backend tmux.Backend, session *tmux.Session, windows []tmux.Window, panes []tmux.Pane) []tmux.Rule {
+	var rules []tmux.Rule
+	for _, window := range windows {
+		var picked []tmux.Pane
+		for _, pane := range panes {
+			if pane.WindowID == window.ID {
+				picked = append(picked, pane)
+			}
+		}
+		if len(picked) == 0 {
+			continue
+		}
+
+		rule := tmux.Rule{Socket: session.Socket, Session: session.Name, Window: tmux.EscapeGlob(window.Name), Panes: tmux.PanesAll}
+		if all, err := backend.GetPanes(session.ID, window.ID); err == nil && len(all) > 1 && len(picked) == 1 && picked[0].Active {
+			rule.Panes = tmux.PanesActive
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func newSender(cfg *config.Config) (*network.DataSender, error) {
+	sender := network.NewDataSender(cfg.CentralServerIP, cfg.CentralPort, cfg.ServerName, cfg.AuthToken)
+	sender.SetAgentVersion(version)
+	sender.SetOptions(senderOptions(cfg))
+	if cfg.TLSEnabled() {
+		tlsConfig, err := network.LoadTLSConfig(cfg.TLSCAFile, cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSServerName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS config: %w", err)
+		}
+		sender.SetTLSConfig(tlsConfig)
+		fmt.Println(successStyle.Render(" TLS enabled"))
+	}
+
+	if sampleSpool, err := openSpool(cfg); err != nil {
+		fmt.Printf(warningStyle.Render(" Spool disabled, samples are lost while the central is down: %v")+"\n", err)
+	} else {
+		sender.SetSpool(sampleSpool)
+		if count, size := sampleSpool.Stats(); count > 0 {
+			fmt.Printf(warningStyle.Render(" %d unsent samples (%d bytes) spooled in %s")+"\n", count, size, sampleSpool.Dir())
+		}
+	}
+
+	return sender, nil
+}
+
+// handleShutdown prints send stats and exits on SIGINT or SIGTERM.
+func handleShutdown(sender *network.DataSender) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-c
-		fmt.Println(infoStyle.Render("\nShutting down..."))
+		fmt.Println()
+		fmt.Println(infoStyle.Render("Shutting down..."))
+		stats := sender.Stats()
+		fmt.Printf(infoStyle.Render(" Sent %d frames: %d bytes raw, %d bytes on the wire, %d spooled, %d replayed, %d dropped, %d reconnects")+"\n",
+			stats.FramesSent, stats.RawBytes, stats.WireBytes, stats.FramesSpooled, stats.FramesReplayed,
+			stats.FramesDropped, stats.Reconnects)
 		sender.Close()
-		os.Exit(0)
+		os.Exit(exitOK)
 	}()
+}
+
+func openSpool(cfg *config.Config) (*spool.Spool, error) {
+	spoolDir, err := config.GetSpoolDir(cfg.ServerName)
+	if err != nil {
+		return nil, err
+	}
+
+	maxBytes, maxAge := cfg.SpoolLimits()
+	return spool.Open(spoolDir, maxBytes, maxAge)
+}
+
+// senderOptions applies the reconnect tuning from the config on top of the
+// sender defaults.
+func senderOptions(cfg *config.Config) network.Options {
+	options := network.DefaultOptions()
+
+	if cfg.DialTimeoutSecs > 0 {
+		options.DialTimeout = time.Duration(cfg.DialTimeoutSecs) * time.Second
+	}
+	if cfg.WriteTimeoutSecs > 0 {
+		options.WriteTimeout = time.Duration(cfg.WriteTimeoutSecs) * time.Second
+	}
+	if cfg.KeepAliveSecs > 0 {
+		options.KeepAlive = time.Duration(cfg.KeepAliveSecs) * time.Second
+	}
+	if cfg.BackoffInitialMs > 0 {
+		options.Backoff.Initial = time.Duration(cfg.BackoffInitialMs) * time.Millisecond
+	}
+	if cfg.BackoffMaxSecs > 0 {
+		options.Backoff.Max = time.Duration(cfg.BackoffMaxSecs) * time.Second
+	}
+	if cfg.BackoffMultiplier >= 1 {
+		options.Backoff.Multiplier = cfg.BackoffMultiplier
+	}
+	if cfg.BackoffJitter > 0 {
+		options.Backoff.Jitter = cfg.BackoffJitter
+	}
 
-	runDataCollection(cfg, selectedSession, selectedPanes, sender)
+	return options
 }
 
 func showExistingConfig(cfg *config.Config) {
@@ -161,21 +304,85 @@ func showExistingConfig(cfg *config.Config) {
 
 	fmt.Printf(" Server Name: %s\n", configStyle.Render(cfg.ServerName))
 	fmt.Printf(" Central Server: %s\n", configStyle.Render(fmt.Sprintf("%s:%s", cfg.CentralServerIP, cfg.CentralPort)))
-	fmt.Printf(" Session: %s\n", configStyle.Render(fmt.Sprintf("%s (ID: %s)", cfg.SessionName, cfg.SessionID)))
-	fmt.Printf(" Windows: %s\n", configStyle.Render(fmt.Sprintf("%d windows", len(cfg.WindowIDs))))
-	fmt.Printf(" Panes: %s\n", configStyle.Render(fmt.Sprintf("%d panes", len(cfg.PaneIDs))))
+	fmt.Printf(" Discovery: %s\n", configStyle.Render(fmt.Sprintf("every %s", cfg.DiscoveryInterval())))
+	if cfg.AuthToken != "" {
+		fmt.Printf(" Auth Token: %s\n", configStyle.Render("configured"))
+	}
+	if cfg.TLSEnabled() {
+		fmt.Printf(" TLS: %s\n", configStyle.Render(fmt.Sprintf("cert %s, CA %s", cfg.TLSCertFile, cfg.TLSCAFile)))
+	}
 
-	if len(cfg.WindowIDs) > 0 {
-		fmt.Printf("   Window IDs: %s\n", configStyle.Render(strings.Join(cfg.WindowIDs, ", ")))
+	if len(cfg.Sockets) > 0 {
+		fmt.Printf(" Tmux Sockets: %s\n", configStyle.Render(strings.Join(cfg.Sockets, ", ")))
 	}
-	if len(cfg.PaneIDs) > 0 {
-		fmt.Printf("   Pane IDs: %s\n", configStyle.Render(strings.Join(cfg.PaneIDs, ", ")))
+
+	for _, rule := range cfg.SelectionRules() {
+		fmt.Printf("   Rule: %s\n", configStyle.Render(describeRule(rule)))
 	}
 
 	fmt.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	fmt.Println()
 }
 
+func describeRule(rule tmux.Rule) string {
+	windows := "all windows"
+	switch {
+	case rule.Window != "" && rule.WindowRegex != "":
+		windows = fmt.Sprintf("windows %q matching /%s/", rule.Window, rule.WindowRegex)
+	case rule.Window != "":
+		windows = fmt.Sprintf("windows %q", rule.Window)
+	case rule.WindowRegex != "":
+		windows = fmt.Sprintf("windows matching /%s/", rule.WindowRegex)
+	}
+
+	panes := "all panes"
+	if rule.Panes == tmux.PanesActive {
+		panes = "active pane"
+	}
+	if rule.Pane != "" {
+		panes += fmt.Sprintf(" matching %q", rule.Pane)
+	}
+	if rule.Scrollback > 0 {
+		panes += fmt.Sprintf(", %d lines of scrollback", rule.Scrollback)
+	}
+	switch rule.Privacy {
+	case tmux.PrivacyMetadata:
+		panes += ", metadata only"
+	case tmux.PrivacyExclude:
+		panes += ", excluded"
+	}
+	session := rule.Session
+	if rule.Socket != "" {
+		session = rule.Socket + ":" + session
+	}
+	return fmt.Sprintf("session %s, %s, %s", session, windows, panes)
+}
+
+// confirm asks a yes/no question on stdin, empty input picks def.
+func confirm(question string, def bool) bool {
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Print(warningStyle.Render(question))
+
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return def
+		}
+
+		switch strings.TrimSpace(strings.ToLower(input)) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		default:
+			fmt.Println(errorStyle.Render(" Please enter 'y' (yes) or 'n' (no)"))
+		}
+	}
+}
+
 func confirmUseExistingConfig() bool {
 	reader := bufio.NewReader(os.Stdin)
 
@@ -184,7 +391,7 @@ func confirmUseExistingConfig() bool {
 
 		input, err := reader.ReadString('\n')
 		if err != nil {
-			fmt.Printf(errorStyle.Render("Error reading input: %v\n"), err)
+			fmt.Printf(errorStyle.Render("Error reading input: %v")+"\n", err)
 			continue
 		}
 
@@ -229,11 +436,12 @@ func runSetupFlow() *config.Config {
 		ServerName:      serverName,
 		CentralServerIP: centralIP,
 		CentralPort:     centralPort,
+		AuthToken:       model.AuthToken(),
 	}
 }
 
-func runSelectionFlow(sessions []tmux.Session) (*tmux.Session, []tmux.Window, []tmux.Pane) {
-	sessionPicker := ui.NewSessionPicker(sessions)
+func runSelectionFlow(backend tmux.Backend, sessions []tmux.Session) (*tmux.Session, []tmux.Window, []tmux.Pane) {
+	sessionPicker := ui.NewSessionPicker(backend, sessions)
 	p := tea.NewProgram(sessionPicker, tea.WithAltScreen())
 
 	m, err := p.Run()
@@ -253,12 +461,12 @@ func runSelectionFlow(sessions []tmux.Session) (*tmux.Session, []tmux.Window, []
 		os.Exit(0)
 	}
 
-	windows, err := tmux.GetWindows(selectedSession.ID)
+	windows, err := backend.GetWindows(selectedSession.ID)
 	if err != nil {
 		log.Fatalf("Failed to get windows: %v", err)
 	}
 
-	windowPicker := ui.NewWindowPicker(selectedSession.Name, windows)
+	windowPicker := ui.NewWindowPicker(backend, selectedSession.Name, windows)
 	p = tea.NewProgram(windowPicker, tea.WithAltScreen())
 
 	m, err = p.Run()
@@ -280,7 +488,7 @@ func runSelectionFlow(sessions []tmux.Session) (*tmux.Session, []tmux.Window, []
 	var allSelectedPanes []tmux.Pane
 
 	for _, window := range selectedWindows {
-		panes, err := tmux.GetPanes(selectedSession.ID, window.ID)
+		panes, err := backend.GetPanes(selectedSession.ID, window.ID)
 		if err != nil {
 			log.Printf("Failed to get panes for window %s: %v", window.Name, err)
 			continue
@@ -291,7 +499,7 @@ func runSelectionFlow(sessions []tmux.Session) (*tmux.Session, []tmux.Window, []
 			continue
 		}
 
-		panePicker := ui.NewPanePicker(window.Name, panes)
+		panePicker := ui.NewPanePicker(backend, window.Name, panes)
 		p = tea.NewProgram(panePicker, tea.WithAltScreen())
 
 		m, err = p.Run()
@@ -313,81 +521,210 @@ func runSelectionFlow(sessions []tmux.Session) (*tmux.Session, []tmux.Window, []
 	return selectedSession, selectedWindows, allSelectedPanes
 }
 
-func runDataCollection(cfg *config.Config, session *tmux.Session, panes []tmux.Pane, sender *network.DataSender) {
+func runDataCollection(cfg *config.Config, backend tmux.Backend, resolver *tmux.Resolver, sender *network.DataSender) {
 	fileLogger := logger.NewLogger(cfg.ServerName)
 	defer fileLogger.Close()
 
-	fileLogger.LogInfo(fmt.Sprintf("Started monitoring session: %s with %d panes", session.Name, len(panes)))
-	fmt.Printf(infoStyle.Render(" Logging to: logs/%s_%s.log\n"), cfg.ServerName, time.Now().Format("2006-01-02"))
+	paneCollector := agent.NewCollector(backend, resolver, cfg.ScrollbackLimit())
+
+	redactor, err := cfg.Redactor()
+	if err != nil {
+		fmt.Printf(errorStyle.Render(" %v")+"\n", err)
+		os.Exit(exitUsage)
+	}
+	if redactor == nil {
+		fmt.Println(warningStyle.Render(" Redaction is off, pane content is sent as is"))
+	} else {
+		paneCollector.SetRedactor(redactor)
+		fmt.Printf(infoStyle.Render(" Redacting secrets with %d detectors")+"\n", len(redactor.Detectors()))
+	}
+	processes := collector.NewProcessSampler()
+	paneCollector.SetProcessSampler(processes)
 
-	fmt.Print(infoStyle.Render(" Establishing TCP connection... "))
-	if err := sender.Connect(); err != nil {
-		fmt.Printf(errorStyle.Render(" FAILED\n"))
-		fmt.Printf(errorStyle.Render("TCP Error: %v\n"), err)
-		os.Exit(1)
+	if changes, err := paneCollector.Discover(); err != nil {
+		fmt.Printf(errorStyle.Render(" Failed to resolve panes: %v")+"\n", err)
+	} else {
+		reportChanges(changes, fileLogger)
 	}
-	fmt.Println(successStyle.Render(" TCP CONNECTION ESTABLISHED"))
+	panes := paneCollector.Panes()
+	fileLogger.LogInfo(fmt.Sprintf("Started monitoring %d panes", len(panes)))
+	fmt.Printf(infoStyle.Render(" Monitoring %d panes, re-resolving every %s")+"\n", len(panes), cfg.DiscoveryInterval())
+	fmt.Printf(infoStyle.Render(" Logging to: logs/%s_%s.log")+"\n", cfg.ServerName, time.Now().Format("2006-01-02"))
+
+	// NOTE: Without a watcher every pane is captured through the backend each tick
+	var watcher *tmux.Watcher
+	var updates <-chan tmux.Update
+	if cfg.Backend == config.BackendControl {
+		watcher = tmux.NewWatcher(cfg.ControlCoalesce())
+		defer watcher.Close()
+		updates = watcher.Updates()
+		paneCollector.SetWatcher(watcher)
+
+		if err := watcher.Watch(panes); err != nil {
+			fmt.Printf(warningStyle.Render(" Control mode: %v")+"\n", err)
+		}
+		fmt.Printf(infoStyle.Render(" Following panes in tmux control mode, coalescing output for %s")+"\n", cfg.ControlCoalesce())
+	}
+
+	central := fmt.Sprintf("%s:%s", cfg.CentralServerIP, cfg.CentralPort)
+
+	// NOTE: The sender connects and reconnects in the background, collection never waits on the network
+	sender.Start()
 
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
 
+	discoveryTicker := time.NewTicker(cfg.DiscoveryInterval())
+	defer discoveryTicker.Stop()
+
 	sendCount := 0
+	sampler := collector.NewSampler(cfg.MountFilter())
+	var stats collector.SystemStats
+	var topProcessesAt time.Time
 
 	for {
+		tick := false
+
 		select {
+		case event := <-sender.Events():
+			handleSenderEvent(event, sender, central, fileLogger)
+			continue
+
+		case <-discoveryTicker.C:
+			paneCollector.Rediscover()
+			continue
+
+		case update := <-updates:
+			if update.Layout {
+				paneCollector.Rediscover()
+			}
+
 		case <-ticker.C:
-			sendCount++
-			timestamp := time.Now()
+			tick = true
+		}
+
+		sendCount++
 
-			stats, err := collector.CollectSystemStats()
+		if paneCollector.NeedsDiscovery() {
+			if changes, err := paneCollector.Discover(); err != nil {
+				fmt.Printf(errorStyle.Render(" Failed to resolve panes: %v")+"\n", err)
+			} else {
+				reportChanges(changes, fileLogger)
+				if watcher != nil {
+					if err := watcher.Watch(paneCollector.Panes()); err != nil {
+						fmt.Printf(warningStyle.Render(" Control mode: %v")+"\n", err)
+					}
+				}
+			}
+		}
+
+		// NOTE: Samples pushed on pane output reuse the last system stats and metadata, those only refresh on ticks
+		if tick || stats.Timestamp.IsZero() {
+			collected, err := sampler.CollectSystemStats()
 			if err != nil {
-				fmt.Printf(errorStyle.Render(" Failed to collect system stats: %v\n"), err)
+				fmt.Printf(errorStyle.Render(" Failed to collect system stats: %v")+"\n", err)
 				fileLogger.LogInfo(fmt.Sprintf("Failed to collect system stats: %v", err))
 				continue
 			}
+			stats = collected
+		}
 
-			var tmuxPanes []network.TmuxPane
-			for _, pane := range panes {
-				content, err := tmux.GetPaneContent(session.ID, pane.WindowID, pane.ID)
-				if err != nil {
-					fmt.Printf(errorStyle.Render(" Failed to get pane %s content: %v\n"), pane.ID, err)
-					continue
-				}
-
-				tmuxPanes = append(tmuxPanes, network.TmuxPane{
-					ID:        pane.ID,
-					WindowID:  pane.WindowID,
-					SessionID: pane.SessionID,
-					Content:   content,
-					Active:    pane.Active,
-				})
+		sample := paneCollector.Collect(tick)
+
+		// NOTE: Collect refreshed the process snapshot on ticks, the top lists reuse it
+		var topProcesses *network.TopProcesses
+		if tick && cfg.TopProcesses > 0 && time.Since(topProcessesAt) >= cfg.TopProcessesInterval() {
+			topProcessesAt = time.Now()
+			byCPU, byMemory := processes.Top(cfg.TopProcesses, redactor)
+			topProcesses = &network.TopProcesses{
+				Timestamp: topProcessesAt,
+				ByCPU:     processInfos(byCPU),
+				ByMemory:  processInfos(byMemory),
 			}
+		}
 
-			sendData := network.SendData{
-				ServerName:  cfg.ServerName,
-				SystemStats: stats,
-				TmuxPanes:   tmuxPanes,
-				SessionName: session.Name,
-			}
+		// NOTE: Older centrals only know one session per server, give them the first
+		sessionName := cfg.SelectionRules()[0].Session
+		if len(sample.Panes) > 0 {
+			sessionName = sample.Panes[0].SessionName
+		}
 
-			fmt.Printf(infoStyle.Render(" Sending TCP packet #%d to %s:%s... "),
-				sendCount, cfg.CentralServerIP, cfg.CentralPort)
+		sender.Enqueue(network.SendData{
+			ServerName:  cfg.ServerName,
+			SystemStats: stats,
+			TmuxPanes:   sample.Panes,
+			Windows:     sample.Windows,
+			SessionName: sessionName,
+			PaneEvents:  sample.PaneEvents,
 
-			if err := sender.SendData(sendData); err != nil {
-				fmt.Printf(errorStyle.Render(" FAILED\n"))
-				fmt.Printf(errorStyle.Render("   TCP Error: %v\n"), err)
-				fileLogger.LogSendFailure(fmt.Sprintf("%s:%s", cfg.CentralServerIP, cfg.CentralPort), err)
+			TopProcesses: topProcesses,
+		})
 
-				fmt.Print(infoStyle.Render(" Attempting TCP reconnection... "))
-				if err := sender.Connect(); err != nil {
-					fmt.Printf(errorStyle.Render(" Reconnection failed: %v\n"), err)
-				} else {
-					fmt.Println(successStyle.Render(" TCP Reconnected"))
-				}
-			} else {
-				fmt.Printf(successStyle.Render(" SUCCESS [%s]\n"), timestamp.Format("15:04:05"))
-				fileLogger.LogSendSuccess(fmt.Sprintf("%s:%s", cfg.CentralServerIP, cfg.CentralPort))
-			}
+		if state := sender.State(); state != network.StateConnected {
+			fmt.Printf(warningStyle.Render(" Sample #%d queued while %s")+"\n", sendCount, state)
 		}
 	}
 }
+
+func processInfos(processes []collector.ProcessDetails) []network.ProcessInfo {
+	infos := make([]network.ProcessInfo, len(processes))
+	for i, p := range processes {
+		infos[i] = network.ProcessInfo{
+			PID:        p.PID,
+			User:       p.User,
+			Command:    p.Cmdline,
+			CPUPercent: p.CPUPercent,
+			RSS:        p.RSS,
+			State:      p.State,
+		}
+	}
+	return infos
+}
+
+// reportChanges prints and logs every pane that appeared or disappeared.
+func reportChanges(changes tmux.Changes, fileLogger *logger.Logger) {
+	report := func(eventType string, panes []tmux.Pane) {
+		for _, pane := range panes {
+			message := fmt.Sprintf("Pane %s %s (window %s, session %s)", pane.ID, eventType, pane.WindowName, pane.SessionName)
+			fmt.Println(infoStyle.Render(" " + message))
+			fileLogger.LogInfo(message)
+		}
+	}
+	report(network.PaneAdded, changes.Added)
+	report(network.PaneRemoved, changes.Removed)
+}
+
+func handleSenderEvent(event network.Event, sender *network.DataSender, central string, fileLogger *logger.Logger) {
+	switch event.Kind {
+	case network.EventStateChanged:
+		switch event.State {
+		case network.StateConnecting:
+			fmt.Printf(infoStyle.Render(" Connecting to %s...")+"\n", central)
+		case network.StateConnected:
+			negotiated := sender.Session()
+			fmt.Printf(successStyle.Render(" Connected to central %s, protocol v%d")+"\n",
+				negotiated.ServerVersion, negotiated.ProtocolVersion)
+			fileLogger.LogInfo(fmt.Sprintf("Connected to %s", central))
+		case network.StateBackingOff:
+			fmt.Printf(errorStyle.Render(" Connection to %s failed: %v")+"\n", central, event.Err)
+			fmt.Printf(warningStyle.Render(" Retrying in %s")+"\n", event.Retry.Round(100*time.Millisecond))
+			fileLogger.LogSendFailure(central, event.Err)
+		}
+
+	case network.EventSent:
+		if unacked := sender.Unacked(); unacked > 1 {
+			fmt.Printf(successStyle.Render(" Sent packet #%d [%s] (%d awaiting ack)")+"\n", event.Seq, time.Now().Format("15:04:05"), unacked)
+		} else {
+			fmt.Printf(successStyle.Render(" Sent packet #%d [%s]")+"\n", event.Seq, time.Now().Format("15:04:05"))
+		}
+		fileLogger.LogSendSuccess(central)
+
+	case network.EventSendFailed:
+		fmt.Printf(errorStyle.Render(" Send failed: %v")+"\n", event.Err)
+		fileLogger.LogSendFailure(central, event.Err)
+
+	case network.EventServerError:
+		fmt.Printf(errorStyle.Render(" Central rejected a frame: %v")+"\n", event.Err)
+		fileLogger.LogInfo(fmt.Sprintf("Central rejected a frame: %v", event.Err))
+	}
+}
@@ -0,0 +1,160 @@
+package network
+
+import (
+	"hash/crc32"
+	"strings"
+	"sync"
+)
+
+// keyframeInterval is how many frames a pane may be sent as deltas before
+// its full content is sent again.
+const keyframeInterval = 30
+
+// PaneDelta replaces TmuxPane.Content with the lines that changed since the
+// previous frame. BaseHash is the CRC32 of the content it applies to, so the
+// central can tell when it is out of sync and ask for a keyframe.
+type PaneDelta struct {
+	BaseHash  uint32       `json:"base_hash"`
+	Unchanged bool         `json:"unchanged,omitempty"`
+	LineCount int          `json:"line_count,omitempty"`
+	Lines     []LineChange `json:"lines,omitempty"`
+}
+
+type LineChange struct {
+	Index int    `json:"i"`
+	Text  string `json:"t"`
+}
+
+type paneState struct {
+	content        string
+	hash           uint32
+	scrollbackHash uint32
+	frames         int
+}
+
+// deltaEncoder remembers the last content sent per pane. Encode only
+// prepares the next state, Commit makes it the base once the frame was
+// written, so a frame that never reaches the central doesn't move the base.
+type deltaEncoder struct {
+	panes       map[string]*paneState
+	pending     map[string]*paneState
+	invalidated map[string]bool
+	mutex       sync.Mutex
+}
+
+func newDeltaEncoder() *deltaEncoder {
+	return &deltaEncoder{panes: make(map[string]*paneState)}
+}
+
+// Reset forgets all panes so the next frame is a full keyframe.
+func (de *deltaEncoder) Reset() {
+	de.mutex.Lock()
+	defer de.mutex.Unlock()
+	de.panes = make(map[string]*paneState)
+	de.pending = nil
+}
+
+// Invalidate forces a keyframe for the given panes on the next frame.
+func (de *deltaEncoder) Invalidate(paneIDs []string) {
+	de.mutex.Lock()
+	defer de.mutex.Unlock()
+	if de.invalidated == nil {
+		de.invalidated = make(map[string]bool)
+	}
+	for _, id := range paneIDs {
+		delete(de.panes, id)
+		de.invalidated[id] = true
+	}
+}
+
+// Commit makes the state prepared by the last Encode the base for the next
+// one. Panes invalidated since that Encode still get a keyframe.
+func (de *deltaEncoder) Commit() {
+	de.mutex.Lock()
+	defer de.mutex.Unlock()
+	if de.pending == nil {
+		return
+	}
+
+	for id := range de.invalidated {
+		delete(de.pending, id)
+	}
+	de.panes = de.pending
+	de.pending = nil
+	de.invalidated = nil
+}
+
+// Encode swaps pane content for deltas where that is smaller and drops
+// scrollback the central already has. The result only becomes the base for
+// the next frame with Commit.
+func (de *deltaEncoder) Encode(panes []TmuxPane) []TmuxPane {
+	de.mutex.Lock()
+	defer de.mutex.Unlock()
+
+	encoded := make([]TmuxPane, len(panes))
+	next := make(map[string]*paneState, len(panes))
+	de.invalidated = nil
+
+	for i, pane := range panes {
+		encoded[i] = pane
+
+		hash := crc32.ChecksumIEEE([]byte(pane.Content))
+		scrollbackHash := crc32.ChecksumIEEE([]byte(pane.Scrollback))
+		prev, exists := de.panes[pane.ID]
+		next[pane.ID] = &paneState{content: pane.Content, hash: hash, scrollbackHash: scrollbackHash}
+
+		if !exists || prev.frames+1 >= keyframeInterval {
+			continue
+		}
+		next[pane.ID].frames = prev.frames + 1
+
+		// NOTE: Scrollback mostly shifts as a whole, so it is only skipped when identical
+		if pane.Scrollback != "" && prev.scrollbackHash == scrollbackHash {
+			encoded[i].Scrollback = ""
+			encoded[i].ScrollbackHash = scrollbackHash
+		}
+
+		if prev.hash == hash && prev.content == pane.Content {
+			encoded[i].Content = ""
+			encoded[i].Delta = &PaneDelta{BaseHash: prev.hash, Unchanged: true}
+			continue
+		}
+
+		delta := diffLines(prev.content, pane.Content)
+		delta.BaseHash = prev.hash
+
+		if delta.size() >= len(pane.Content) {
+			next[pane.ID].frames = 0
+			continue
+		}
+
+		encoded[i].Content = ""
+		encoded[i].Delta = delta
+	}
+
+	// NOTE: Panes left out of this frame are forgotten once it is committed
+	de.pending = next
+	return encoded
+}
+
+func diffLines(oldContent, newContent string) *PaneDelta {
+	oldLines := strings.Split(oldContent, "\n")
+	newLines := strings.Split(newContent, "\n")
+
+	delta := &PaneDelta{LineCount: len(newLines)}
+	for i, line := range newLines {
+		if i >= len(oldLines) || oldLines[i] != line {
+			delta.Lines = append(delta.Lines, LineChange{Index: i, Text: line})
+		}
+	}
+	return delta
+}
+
+// size approximates the encoded size of the changed lines.
+func (d *PaneDelta) size() int {
+	size := 0
+	for _, line := range d.Lines {
+		size += len(line.Text) + 16
+	}
+	return size
+}
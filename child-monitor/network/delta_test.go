@@ -0,0 +1,150 @@
+package network
+
+import (
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// applyDelta rebuilds content the way the central does.
+func applyDelta(base string, delta *PaneDelta) string {
+	if delta.Unchanged {
+		return base
+	}
+	lines := make([]string, delta.LineCount)
+	copy(lines, strings.Split(base, "\n"))
+	for _, change := range delta.Lines {
+		lines[change.Index] = change.Text
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDeltaEncoder(t *testing.T) {
+	screen := strings.Repeat("a fairly long line of terminal output\n", 10)
+	changed := strings.Replace(screen, "a fairly", "a really", 1)
+	replaced := strings.Repeat("something else entirely, every line\n", 10)
+
+	type step struct {
+		content    string
+		scrollback string
+		invalidate bool // before Encode
+		lateResync bool // between Encode and Commit
+		noCommit   bool
+		keyframe   bool
+		unchanged  bool
+		omitted    bool // scrollback left out as unchanged
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "keyframe, unchanged, then changed lines",
+			steps: []step{
+				{content: screen, keyframe: true},
+				{content: screen, unchanged: true},
+				{content: changed},
+			},
+		},
+		{
+			name: "delta bigger than the content",
+			steps: []step{
+				{content: screen, keyframe: true},
+				{content: replaced, keyframe: true},
+			},
+		},
+		{
+			name: "uncommitted frame doesn't move the base",
+			steps: []step{
+				{content: screen, keyframe: true},
+				{content: changed, noCommit: true},
+				{content: changed},
+			},
+		},
+		{
+			name: "resync before the frame",
+			steps: []step{
+				{content: screen, keyframe: true},
+				{content: screen, invalidate: true, keyframe: true},
+			},
+		},
+		{
+			name: "resync while the frame is being written",
+			steps: []step{
+				{content: screen, keyframe: true},
+				{content: screen, unchanged: true, lateResync: true},
+				{content: screen, keyframe: true},
+			},
+		},
+		{
+			name: "unchanged scrollback is left out",
+			steps: []step{
+				{content: screen, scrollback: "history\n", keyframe: true},
+				{content: screen, scrollback: "history\n", unchanged: true, omitted: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := newDeltaEncoder()
+			base := ""
+
+			for i, s := range tt.steps {
+				if s.invalidate {
+					encoder.Invalidate([]string{"%0"})
+				}
+				pane := encoder.Encode([]TmuxPane{{ID: "%0", Content: s.content, Scrollback: s.scrollback}})[0]
+				if s.lateResync {
+					encoder.Invalidate([]string{"%0"})
+				}
+				if !s.noCommit {
+					encoder.Commit()
+				}
+
+				switch {
+				case s.keyframe:
+					if pane.Delta != nil || pane.Content != s.content {
+						t.Fatalf("step %d: got delta %+v, want a keyframe", i, pane.Delta)
+					}
+				case pane.Delta == nil:
+					t.Fatalf("step %d: got a keyframe, want a delta", i)
+				default:
+					if pane.Delta.BaseHash != crc32.ChecksumIEEE([]byte(base)) {
+						t.Fatalf("step %d: delta base hash doesn't match the last committed content", i)
+					}
+					if pane.Delta.Unchanged != s.unchanged {
+						t.Errorf("step %d: unchanged = %v, want %v", i, pane.Delta.Unchanged, s.unchanged)
+					}
+					if got := applyDelta(base, pane.Delta); got != s.content {
+						t.Fatalf("step %d: applied delta = %q, want %q", i, got, s.content)
+					}
+				}
+
+				if omitted := pane.Scrollback == "" && pane.ScrollbackHash != 0; omitted != s.omitted {
+					t.Errorf("step %d: scrollback omitted = %v, want %v", i, omitted, s.omitted)
+				}
+
+				if !s.noCommit {
+					base = s.content
+				}
+			}
+		})
+	}
+}
+
+func TestDeltaEncoderKeyframeInterval(t *testing.T) {
+	encoder := newDeltaEncoder()
+
+	keyframes := 0
+	for i := 0; i < 2*keyframeInterval; i++ {
+		if pane := encoder.Encode([]TmuxPane{{ID: "%0", Content: "same\n"}})[0]; pane.Delta == nil {
+			keyframes++
+		}
+		encoder.Commit()
+	}
+	if keyframes != 2 {
+		t.Errorf("%d keyframes in %d frames, want 2", keyframes, 2*keyframeInterval)
+	}
+}
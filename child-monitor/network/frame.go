@@ -0,0 +1,66 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Protocol v1 sends one JSON document per line. Protocol v2 and later
+// prefix every frame with a 5 byte header: a big-endian uint32 payload
+// length followed by a flags byte.
+const frameHeaderSize = 5
+
+// Frame flags.
+const (
+	FlagGzip byte = 1 << iota
+)
+
+// maxReplySize bounds frames read back from the central server.
+const maxReplySize = 1024 * 1024
+
+type Frame struct {
+	Flags   byte
+	Payload []byte
+}
+
+func encodeFrame(protocolVersion int, frame Frame) []byte {
+	if protocolVersion < 2 {
+		return append(frame.Payload, '\n')
+	}
+
+	buf := make([]byte, frameHeaderSize+len(frame.Payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(frame.Payload)))
+	buf[4] = frame.Flags
+	copy(buf[frameHeaderSize:], frame.Payload)
+	return buf
+}
+
+func readFrame(protocolVersion int, r *bufio.Reader) (Frame, error) {
+	if protocolVersion < 2 {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return Frame{}, err
+		}
+		return Frame{Payload: bytes.TrimRight(line, "\r\n")}, nil
+	}
+
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	size := int(binary.BigEndian.Uint32(header[:4]))
+	if size > maxReplySize {
+		return Frame{}, fmt.Errorf("reply frame of %d bytes exceeds limit of %d bytes", size, maxReplySize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Frame{}, err
+	}
+
+	return Frame{Flags: header[4], Payload: payload}, nil
+}
@@ -0,0 +1,43 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int
+		frame           Frame
+	}{
+		{name: "v1 line", protocolVersion: 1, frame: Frame{Payload: []byte(`{"type":"ack","seq":7}`)}},
+		{name: "v2 plain", protocolVersion: 2, frame: Frame{Payload: []byte("line one\nline two")}},
+		{name: "v2 gzip", protocolVersion: 2, frame: Frame{Flags: FlagGzip, Payload: []byte("\x1f\x8b\x00\n")}},
+		{name: "v2 empty", protocolVersion: 2, frame: Frame{Payload: []byte{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wire := encodeFrame(tt.protocolVersion, tt.frame)
+			got, err := readFrame(tt.protocolVersion, bufio.NewReader(bytes.NewReader(wire)))
+			if err != nil {
+				t.Fatalf("readFrame: %v", err)
+			}
+			if got.Flags != tt.frame.Flags || !bytes.Equal(got.Payload, tt.frame.Payload) {
+				t.Errorf("readFrame = %+v, want %+v", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], maxReplySize+1)
+
+	if _, err := readFrame(2, bufio.NewReader(bytes.NewReader(header[:]))); err == nil {
+		t.Error("readFrame accepted a reply larger than maxReplySize")
+	}
+}
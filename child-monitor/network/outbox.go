@@ -0,0 +1,101 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// maxUnacked bounds how many frames are kept for replay while the central
+// hasn't acknowledged them. About 17 minutes of samples at 2s intervals.
+const maxUnacked = 512
+
+// outbox numbers outgoing samples and keeps them until the central acks
+// them, so they can be resent after a reconnect.
+type outbox struct {
+	agentSession string
+	nextSeq      uint64
+	pending      []SendData
+	dropped      uint64
+	mutex        sync.Mutex
+}
+
+func newOutbox() *outbox {
+	return &outbox{
+		agentSession: newAgentSession(),
+		nextSeq:      1,
+	}
+}
+
+func newAgentSession() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Add assigns the next sequence number to data and keeps it for replay.
+func (o *outbox) Add(data SendData) SendData {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	data.Seq = o.nextSeq
+	o.nextSeq++
+
+	o.pending = append(o.pending, data)
+	if len(o.pending) > maxUnacked {
+		o.dropped += uint64(len(o.pending) - maxUnacked)
+		o.pending = o.pending[len(o.pending)-maxUnacked:]
+	}
+
+	return data
+}
+
+// Ack drops every pending frame up to and including seq.
+func (o *outbox) Ack(seq uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	i := 0
+	for i < len(o.pending) && o.pending[i].Seq <= seq {
+		i++
+	}
+	o.pending = o.pending[i:]
+}
+
+// Remove drops a single frame that can never be delivered.
+func (o *outbox) Remove(seq uint64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for i, data := range o.pending {
+		if data.Seq == seq {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Clear forgets all pending frames, used when the central can't ack.
+func (o *outbox) Clear() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.pending = nil
+}
+
+func (o *outbox) Pending() []SendData {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	pending := make([]SendData, len(o.pending))
+	copy(pending, o.pending)
+	return pending
+}
+
+func (o *outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.pending)
+}
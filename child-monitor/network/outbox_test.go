@@ -0,0 +1,54 @@
+package network
+
+import (
+	"slices"
+	"testing"
+)
+
+func pendingSeqs(o *outbox) []uint64 {
+	var seqs []uint64
+	for _, data := range o.Pending() {
+		seqs = append(seqs, data.Seq)
+	}
+	return seqs
+}
+
+func TestOutbox(t *testing.T) {
+	o := newOutbox()
+	for i := 0; i < 5; i++ {
+		if data := o.Add(SendData{}); data.Seq != uint64(i+1) {
+			t.Fatalf("Add #%d got seq %d", i+1, data.Seq)
+		}
+	}
+
+	o.Ack(2)
+	if got := pendingSeqs(o); !slices.Equal(got, []uint64{3, 4, 5}) {
+		t.Errorf("after Ack(2) pending = %v, want [3 4 5]", got)
+	}
+
+	o.Remove(4)
+	o.Ack(1)
+	if got := pendingSeqs(o); !slices.Equal(got, []uint64{3, 5}) {
+		t.Errorf("after Remove(4) and a stale ack pending = %v, want [3 5]", got)
+	}
+
+	o.Ack(5)
+	if o.Len() != 0 {
+		t.Errorf("after Ack(5) %d frames pending", o.Len())
+	}
+	if data := o.Add(SendData{}); data.Seq != 6 {
+		t.Errorf("seq after acks = %d, want 6", data.Seq)
+	}
+}
+
+func TestOutboxBound(t *testing.T) {
+	o := newOutbox()
+	for i := 0; i < maxUnacked+10; i++ {
+		o.Add(SendData{})
+	}
+
+	pending := pendingSeqs(o)
+	if len(pending) != maxUnacked || pending[0] != 11 {
+		t.Errorf("pending = %d frames from #%d, want %d from #11", len(pending), pending[0], maxUnacked)
+	}
+}
@@ -0,0 +1,53 @@
+package network
+
+const (
+	FrameHello   = "hello"
+	FrameHelloOK = "hello_ok"
+	FrameError   = "error"
+	FrameResync  = "resync"
+	FrameAck     = "ack"
+)
+
+// ProtocolVersion is the wire protocol this agent speaks. The central may
+// answer with a lower version, which the agent then uses for the connection.
+//
+// v1: newline-delimited JSON frames.
+// v2: length-prefixed frames, see frame.go.
+const ProtocolVersion = 2
+
+// CapabilityGzip means frames may be gzip compressed (FlagGzip).
+// CapabilityPaneDelta means panes may carry a PaneDelta instead of Content.
+// CapabilityAck means the central acks every sequenced data frame.
+const (
+	CapabilityGzip      = "gzip"
+	CapabilityPaneDelta = "pane_delta"
+	CapabilityAck       = "ack"
+)
+
+// Capabilities lists optional protocol features offered in the hello frame.
+var Capabilities = []string{CapabilityGzip, CapabilityPaneDelta, CapabilityAck}
+
+// Hello is the first line sent on every connection to the central server.
+type Hello struct {
+	Type            string   `json:"type"`
+	ServerName      string   `json:"server_name"`
+	Token           string   `json:"token,omitempty"`
+	ProtocolVersion int      `json:"protocol_version"`
+	AgentVersion    string   `json:"agent_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	// AgentSession identifies this run of the agent. Sequence numbers
+	// restart from 1 whenever it changes.
+	AgentSession string `json:"agent_session,omitempty"`
+}
+
+// Reply is a message sent back by the central server.
+type Reply struct {
+	Type            string   `json:"type"`
+	Error           string   `json:"error,omitempty"`
+	ProtocolVersion int      `json:"protocol_version,omitempty"`
+	ServerVersion   string   `json:"server_version,omitempty"`
+	Capabilities    []string `json:"capabilities,omitempty"`
+	MaxFrameSize    int      `json:"max_frame_size,omitempty"`
+	Panes           []string `json:"panes,omitempty"`
+	Seq             uint64   `json:"seq,omitempty"`
+}
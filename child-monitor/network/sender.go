@@ -1,104 +1,730 @@
 package network
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"sync"
 	"time"
 )
 
+// ErrFrameTooLarge is returned for samples bigger than the central accepts.
+// They are dropped rather than kept for replay.
+var ErrFrameTooLarge = errors.New("frame exceeds central frame limit")
+
+// ErrRejected is returned when the central refuses the hello, e.g. for a
+// bad token. Retrying won't help until the agent is reconfigured.
+var ErrRejected = errors.New("agent rejected")
+
+var errSenderClosed = errors.New("sender closed")
+
+// DataSender owns the connection to the central server. After Start it
+// connects, replays unacked and spooled samples, and reconnects with
+// backoff in the background; callers only Enqueue samples.
 type DataSender struct {
-	serverIP  string
-	port      string
-	conn      net.Conn
-	connected bool
+	serverIP     string
+	port         string
+	serverName   string
+	token        string
+	agentVersion string
+	options      Options
+	tlsConfig    *tls.Config
+
+	queue     chan SendData
+	events    chan Event
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Owned by the run loop.
+	conn       net.Conn
+	gzipWriter *gzip.Writer
+	gzipBuffer bytes.Buffer
+
+	deltas *deltaEncoder
+	outbox *outbox
+	spool  Spooler
+
+	mutex   sync.RWMutex
+	state   ConnState
+	session Session
+	stats   SendStats
+}
+
+// Spooler persists samples that could not be sent, see package spool.
+type Spooler interface {
+	Append(payload []byte) error
+	Replay(send func(payload []byte) error) (int, error)
+}
+
+// SendStats counts what the sender has written. RawBytes is the JSON
+// payload size before compression, WireBytes what went over the socket.
+type SendStats struct {
+	FramesSent     uint64
+	FramesReplayed uint64
+	FramesSpooled  uint64
+	FramesDropped  uint64
+	RawBytes       uint64
+	WireBytes      uint64
+	Reconnects     uint64
+}
+
+// Session is what was negotiated with the central on the current connection.
+type Session struct {
+	ProtocolVersion int
+	ServerVersion   string
+	Capabilities    []string
+	MaxFrameSize    int
 }
 
 type SendData struct {
-	ServerName  string     `json:"server_name"`
-	Timestamp   time.Time  `json:"timestamp"`
-	SystemStats any        `json:"system_stats"`
-	TmuxPanes   []TmuxPane `json:"tmux_panes"`
-	SessionName string     `json:"session_name"`
+	ServerName  string       `json:"server_name"`
+	Seq         uint64       `json:"seq,omitempty"`
+	Timestamp   time.Time    `json:"timestamp"`
+	Replayed    bool         `json:"replayed,omitempty"`
+	SystemStats any          `json:"system_stats"`
+	TmuxPanes   []TmuxPane   `json:"tmux_panes"`
+	Windows     []TmuxWindow `json:"windows,omitempty"`
+	SessionName string       `json:"session_name"`
+	PaneEvents  []PaneEvent  `json:"pane_events,omitempty"`
+	// TopProcesses is only set on the samples it was refreshed for.
+	TopProcesses *TopProcesses `json:"top_processes,omitempty"`
 }
 
+// TopProcesses are the host's processes using the most CPU and memory.
+type TopProcesses struct {
+	Timestamp time.Time     `json:"timestamp"`
+	ByCPU     []ProcessInfo `json:"by_cpu"`
+	ByMemory  []ProcessInfo `json:"by_memory"`
+}
+
+// ProcessInfo is one entry of a top list, Command is truncated and
+// redacted.
+type ProcessInfo struct {
+	PID        int32   `json:"pid"`
+	User       string  `json:"user,omitempty"`
+	Command    string  `json:"command"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
+	State      string  `json:"state,omitempty"`
+}
+
+const (
+	PaneAdded   = "added"
+	PaneRemoved = "removed"
+)
+
+// PaneEvent reports a pane that started or stopped matching the agent's
+// selection rules since the previous sample.
+type PaneEvent struct {
+	Type       string `json:"type"`
+	PaneID     string `json:"pane_id"`
+	WindowID   string `json:"window_id"`
+	WindowName string `json:"window_name,omitempty"`
+	SessionID  string `json:"session_id"`
+}
+
+// TmuxPane IDs are qualified with Socket for panes not on the default tmux
+// socket, so panes from different servers never share an ID.
 type TmuxPane struct {
+	ID          string     `json:"id"`
+	WindowID    string     `json:"window_id"`
+	WindowName  string     `json:"window_name,omitempty"`
+	SessionID   string     `json:"session_id"`
+	SessionName string     `json:"session_name,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	Delta       *PaneDelta `json:"delta,omitempty"`
+	// Scrollback is the history above Content. When it hasn't changed
+	// since the previous frame it is left out and ScrollbackHash is set.
+	Scrollback     string `json:"scrollback,omitempty"`
+	ScrollbackHash uint32 `json:"scrollback_hash,omitempty"`
+	Active         bool   `json:"active"`
+	CurrentCommand string `json:"current_command,omitempty"`
+	PID            int    `json:"pid,omitempty"`
+	CurrentPath    string `json:"current_path,omitempty"`
+	Title          string `json:"title,omitempty"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	Left           int    `json:"left"`
+	Top            int    `json:"top"`
+	Dead           bool   `json:"dead,omitempty"`
+	Socket         string `json:"socket,omitempty"`
+	// Privacy is the policy the pane was selected with. Metadata only panes
+	// have no content, scrollback or title; LastActivity is the unix time
+	// their screen last changed, zero until it does.
+	Privacy      string `json:"privacy,omitempty"`
+	LastActivity int64  `json:"last_activity,omitempty"`
+	// Usage is what the pane's process tree uses, from its pane_pid down.
+	Usage *PaneUsage `json:"usage,omitempty"`
+}
+
+// PaneUsage adds up the processes running in a pane. Top are the children
+// using the most CPU.
+type PaneUsage struct {
+	CPUPercent float64        `json:"cpu_percent"`
+	RSS        uint64         `json:"rss"`
+	Threads    int            `json:"threads"`
+	Processes  int            `json:"processes"`
+	Top        []ProcessUsage `json:"top,omitempty"`
+}
+
+type ProcessUsage struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss"`
+}
+
+// TmuxWindow describes a window that has monitored panes. Layout is tmux's
+// window_layout string, pane coordinates are in TmuxPane.
+type TmuxWindow struct {
 	ID        string `json:"id"`
-	WindowID  string `json:"window_id"`
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
 	SessionID string `json:"session_id"`
-	Content   string `json:"content"`
 	Active    bool   `json:"active"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Layout    string `json:"layout"`
+	Socket    string `json:"socket,omitempty"`
 }
 
-func NewDataSender(serverIP, port string) *DataSender {
+func NewDataSender(serverIP, port, serverName, token string) *DataSender {
 	return &DataSender{
-		serverIP: serverIP,
-		port:     port,
+		serverIP:   serverIP,
+		port:       port,
+		serverName: serverName,
+		token:      token,
+		options:    DefaultOptions(),
+		events:     make(chan Event, 64),
+		done:       make(chan struct{}),
+		deltas:     newDeltaEncoder(),
+		outbox:     newOutbox(),
+	}
+}
+
+func (ds *DataSender) SetAgentVersion(version string) {
+	ds.agentVersion = version
+}
+
+func (ds *DataSender) SetOptions(options Options) {
+	ds.options = options
+}
+
+func (ds *DataSender) SetSpool(spool Spooler) {
+	ds.spool = spool
+}
+
+func (ds *DataSender) SetTLSConfig(tlsConfig *tls.Config) {
+	ds.tlsConfig = tlsConfig
+}
+
+// Start launches the background connection loop.
+func (ds *DataSender) Start() {
+	queueSize := ds.options.QueueSize
+	if queueSize <= 0 {
+		queueSize = DefaultOptions().QueueSize
+	}
+	ds.queue = make(chan SendData, queueSize)
+
+	go ds.run()
+}
+
+// Enqueue hands a sample to the background loop without blocking. If the
+// queue is full the oldest queued sample is dropped; the loop itself spools
+// what arrives while disconnected.
+func (ds *DataSender) Enqueue(data SendData) {
+	if data.Timestamp.IsZero() {
+		data.Timestamp = time.Now()
+	}
+
+	// NOTE: Spooling here would deliver the sample after newer ones, the spool is only replayed on reconnect
+	for {
+		select {
+		case ds.queue <- data:
+			return
+		default:
+		}
+
+		select {
+		case <-ds.queue:
+			ds.updateStats(func(stats *SendStats) { stats.FramesDropped++ })
+		default:
+		}
+	}
+}
+
+// Events reports state changes, sends and errors from the background loop.
+func (ds *DataSender) Events() <-chan Event {
+	return ds.events
+}
+
+func (ds *DataSender) State() ConnState {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.state
+}
+
+// Session returns what was negotiated on the current connection.
+func (ds *DataSender) Session() Session {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.session
+}
+
+func (ds *DataSender) Stats() SendStats {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return ds.stats
+}
+
+// Unacked returns how many frames are waiting for an ack from the central.
+func (ds *DataSender) Unacked() int {
+	return ds.outbox.Len()
+}
+
+func (ds *DataSender) IsConnected() bool {
+	return ds.State() == StateConnected
+}
+
+func (ds *DataSender) Close() error {
+	ds.closeOnce.Do(func() {
+		close(ds.done)
+	})
+	return nil
+}
+
+func (ds *DataSender) emit(event Event) {
+	select {
+	case ds.events <- event:
+	default:
+	}
+}
+
+func (ds *DataSender) setState(state ConnState, err error, retry time.Duration) {
+	ds.mutex.Lock()
+	ds.state = state
+	ds.mutex.Unlock()
+
+	ds.emit(Event{Kind: EventStateChanged, State: state, Err: err, Retry: retry})
+}
+
+func (ds *DataSender) updateStats(update func(stats *SendStats)) {
+	ds.mutex.Lock()
+	update(&ds.stats)
+	ds.mutex.Unlock()
+}
+
+// stableConnection is how long a connection has to stay up before the
+// backoff starts over, so a central that accepts and drops connections
+// still gets backed off from.
+const stableConnection = 30 * time.Second
+
+func (ds *DataSender) run() {
+	attempt := 0
+	connected := false
+
+	for {
+		ds.setState(StateConnecting, nil, 0)
+
+		connLost, err := ds.connect()
+		if err == nil {
+			if connected {
+				ds.updateStats(func(stats *SendStats) { stats.Reconnects++ })
+			}
+			connected = true
+
+			connectedAt := time.Now()
+			ds.setState(StateConnected, nil, 0)
+			err = ds.serve(connLost)
+			ds.disconnect()
+
+			if time.Since(connectedAt) >= stableConnection {
+				attempt = 0
+			}
+		}
+
+		if errors.Is(err, errSenderClosed) {
+			ds.setState(StateDisconnected, nil, 0)
+			return
+		}
+
+		delay := ds.options.Backoff.Delay(attempt)
+		attempt++
+		ds.setState(StateBackingOff, err, delay)
+
+		if !ds.waitBackoff(delay) {
+			ds.setState(StateDisconnected, nil, 0)
+			return
+		}
+	}
+}
+
+// serve writes queued samples until the connection fails or the sender is
+// closed.
+func (ds *DataSender) serve(connLost <-chan error) error {
+	for {
+		select {
+		case data := <-ds.queue:
+			if err := ds.send(data); err != nil {
+				return err
+			}
+		case err := <-connLost:
+			return fmt.Errorf("connection lost: %w", err)
+		case <-ds.done:
+			return errSenderClosed
+		}
+	}
+}
+
+// waitBackoff spools samples that arrive while disconnected. It returns
+// false if the sender was closed.
+func (ds *DataSender) waitBackoff(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case data := <-ds.queue:
+			ds.spoolData(data)
+		case <-timer.C:
+			return true
+		case <-ds.done:
+			return false
+		}
+	}
+}
+
+func (ds *DataSender) dial(address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   ds.options.DialTimeout,
+		KeepAlive: ds.options.KeepAlive,
+	}
+	if ds.tlsConfig == nil {
+		return dialer.Dial("tcp", address)
+	}
+
+	tlsConfig := ds.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = ds.serverIP
 	}
+	return tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
 }
 
-func (ds *DataSender) Connect() error {
+// connect dials, handshakes and replays anything not yet delivered. The
+// returned channel receives an error when the central closes the socket.
+func (ds *DataSender) connect() (<-chan error, error) {
 	address := net.JoinHostPort(ds.serverIP, ds.port)
 
-	conn, err := net.Dial("tcp", address)
+	conn, err := ds.dial(address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	reader := bufio.NewReader(conn)
+	session, err := ds.handshake(conn, reader)
 	if err != nil {
-		ds.connected = false
-		return fmt.Errorf("failed to connect to %s: %w", address, err)
+		conn.Close()
+		return nil, err
 	}
 
+	ds.mutex.Lock()
+	ds.session = session
+	ds.mutex.Unlock()
+
 	ds.conn = conn
-	ds.connected = true
-	return nil
+	ds.deltas.Reset()
+
+	connLost := make(chan error, 1)
+	go ds.readReplies(reader, session.ProtocolVersion, connLost)
+
+	if err := ds.replay(); err != nil {
+		ds.disconnect()
+		return nil, err
+	}
+	return connLost, nil
+}
+
+func (ds *DataSender) disconnect() {
+	if ds.conn != nil {
+		ds.conn.Close()
+		ds.conn = nil
+	}
+}
+
+func (ds *DataSender) acksEnabled() bool {
+	return slices.Contains(ds.Session().Capabilities, CapabilityAck)
+}
+
+// replay resends unacked frames and then the spool, oldest first.
+func (ds *DataSender) replay() error {
+	if !ds.acksEnabled() {
+		ds.outbox.Clear()
+	}
+
+	for _, data := range ds.outbox.Pending() {
+		data.Replayed = true
+		if err := ds.writeData(data); err != nil {
+			if errors.Is(err, ErrFrameTooLarge) {
+				continue
+			}
+			return fmt.Errorf("failed to replay frame #%d: %w", data.Seq, err)
+		}
+		ds.updateStats(func(stats *SendStats) { stats.FramesReplayed++ })
+	}
+
+	return ds.replaySpool()
+}
+
+// readReplies consumes frames the central sends back after the handshake
+// until the connection is closed.
+func (ds *DataSender) readReplies(reader *bufio.Reader, protocolVersion int, connLost chan<- error) {
+	for {
+		frame, err := readFrame(protocolVersion, reader)
+		if err != nil {
+			connLost <- err
+			return
+		}
+
+		var reply Reply
+		if err := json.Unmarshal(frame.Payload, &reply); err != nil {
+			continue
+		}
+
+		switch reply.Type {
+		case FrameError:
+			ds.emit(Event{Kind: EventServerError, State: ds.State(), Err: errors.New(reply.Error)})
+		case FrameResync:
+			ds.deltas.Invalidate(reply.Panes)
+		case FrameAck:
+			ds.outbox.Ack(reply.Seq)
+		}
+	}
 }
 
+func (ds *DataSender) handshake(conn net.Conn, reader *bufio.Reader) (Session, error) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	hello, err := json.Marshal(Hello{
+		Type:            FrameHello,
+		ServerName:      ds.serverName,
+		Token:           ds.token,
+		ProtocolVersion: ProtocolVersion,
+		AgentVersion:    ds.agentVersion,
+		Capabilities:    Capabilities,
+		AgentSession:    ds.outbox.agentSession,
+	})
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to marshal hello: %w", err)
+	}
+
+	if _, err := conn.Write(append(hello, '\n')); err != nil {
+		return Session{}, fmt.Errorf("failed to send hello: %w", err)
+	}
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return Session{}, fmt.Errorf("failed to read hello reply: %w", err)
+	}
+
+	var reply Reply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		return Session{}, fmt.Errorf("invalid hello reply: %w", err)
+	}
+
+	switch reply.Type {
+	case FrameHelloOK:
+	case FrameError:
+		return Session{}, fmt.Errorf("%w by central server %s: %s", ErrRejected, reply.ServerVersion, reply.Error)
+	default:
+		return Session{}, fmt.Errorf("unexpected hello reply %q", reply.Type)
+	}
+
+	if reply.ProtocolVersion < 1 || reply.ProtocolVersion > ProtocolVersion {
+		return Session{}, fmt.Errorf("central server %s chose unsupported protocol version %d (agent supports up to %d)",
+			reply.ServerVersion, reply.ProtocolVersion, ProtocolVersion)
+	}
+
+	return Session{
+		ProtocolVersion: reply.ProtocolVersion,
+		ServerVersion:   reply.ServerVersion,
+		Capabilities:    reply.Capabilities,
+		MaxFrameSize:    reply.MaxFrameSize,
+	}, nil
+}
+
+// TestConnection dials and handshakes once without starting the sender.
 func (ds *DataSender) TestConnection() error {
 	address := net.JoinHostPort(ds.serverIP, ds.port)
 
-	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	conn, err := ds.dial(address)
 	if err != nil {
 		return fmt.Errorf("connection test failed to %s: %w", address, err)
 	}
-	conn.Close()
+	defer conn.Close()
+
+	_, err = ds.handshake(conn, bufio.NewReader(conn))
+	return err
+}
+
+// send numbers data and writes it. When the central acks frames, data is
+// kept until acked and replayed after the next reconnect if the write fails.
+func (ds *DataSender) send(data SendData) error {
+	data = ds.outbox.Add(data)
+	if !ds.acksEnabled() {
+		ds.outbox.Clear()
+	}
 
+	err := ds.writeData(data)
+	if errors.Is(err, ErrFrameTooLarge) {
+		ds.updateStats(func(stats *SendStats) { stats.FramesDropped++ })
+		ds.emit(Event{Kind: EventSendFailed, State: StateConnected, Seq: data.Seq, Err: err})
+		return nil
+	}
+	if err != nil {
+		if !ds.acksEnabled() {
+			ds.spoolData(data)
+		}
+		ds.emit(Event{Kind: EventSendFailed, State: StateConnected, Seq: data.Seq, Err: err})
+		return err
+	}
+
+	ds.emit(Event{Kind: EventSent, State: StateConnected, Seq: data.Seq})
 	return nil
 }
 
-func (ds *DataSender) SendData(data SendData) error {
-	if !ds.connected || ds.conn == nil {
-		if err := ds.Connect(); err != nil {
+// spoolData keeps a sample that couldn't be sent for replay on reconnect.
+func (ds *DataSender) spoolData(data SendData) {
+	if ds.spool == nil {
+		ds.updateStats(func(stats *SendStats) { stats.FramesDropped++ })
+		return
+	}
+
+	data.Seq = 0
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	if err := ds.spool.Append(payload); err != nil {
+		ds.updateStats(func(stats *SendStats) { stats.FramesDropped++ })
+		ds.emit(Event{Kind: EventSendFailed, State: ds.State(), Err: fmt.Errorf("failed to spool sample: %w", err)})
+		return
+	}
+	ds.updateStats(func(stats *SendStats) { stats.FramesSpooled++ })
+}
+
+// replaySpool sends spooled samples in order, after any unacked frames.
+func (ds *DataSender) replaySpool() error {
+	if ds.spool == nil {
+		return nil
+	}
+
+	_, err := ds.spool.Replay(func(payload []byte) error {
+		select {
+		case <-ds.done:
+			return errSenderClosed
+		default:
+		}
+
+		var data SendData
+		if err := json.Unmarshal(payload, &data); err != nil {
+			return nil // NOTE: Drop corrupt spool entries instead of blocking the queue
+		}
+
+		data.Replayed = true
+		data = ds.outbox.Add(data)
+		if !ds.acksEnabled() {
+			ds.outbox.Clear()
+		}
+
+		if err := ds.writeData(data); err != nil && !errors.Is(err, ErrFrameTooLarge) {
 			return err
 		}
+		ds.updateStats(func(stats *SendStats) { stats.FramesReplayed++ })
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay spool: %w", err)
 	}
+	return nil
+}
 
-	data.Timestamp = time.Now()
+func (ds *DataSender) writeData(data SendData) error {
+	session := ds.Session()
+
+	// NOTE: The agent owns the delta base. Replayed frames may be duplicates the central skips, so they
+	// go out whole and the first live frame after them is a keyframe again
+	if slices.Contains(session.Capabilities, CapabilityPaneDelta) {
+		if data.Replayed {
+			ds.deltas.Reset()
+		} else {
+			data.TmuxPanes = ds.deltas.Encode(data.TmuxPanes)
+		}
+	}
 
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return fmt.Errorf("failed to marshal data: %w", err)
 	}
 
-	jsonData = append(jsonData, '\n')
+	if session.MaxFrameSize > 0 && len(jsonData) > session.MaxFrameSize {
+		ds.outbox.Remove(data.Seq)
+		return fmt.Errorf("%w: %d bytes, limit %d bytes", ErrFrameTooLarge, len(jsonData), session.MaxFrameSize)
+	}
 
-	_, err = ds.conn.Write(jsonData)
-	if err != nil {
-		ds.connected = false
-		ds.conn = nil
+	frame := Frame{Payload: jsonData}
+	if slices.Contains(session.Capabilities, CapabilityGzip) {
+		compressed, err := ds.compress(jsonData)
+		if err != nil {
+			return fmt.Errorf("failed to compress data: %w", err)
+		}
+		frame = Frame{Flags: FlagGzip, Payload: compressed}
+	}
+
+	if ds.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	wire := encodeFrame(session.ProtocolVersion, frame)
+	if ds.options.WriteTimeout > 0 {
+		ds.conn.SetWriteDeadline(time.Now().Add(ds.options.WriteTimeout))
+	}
+	if _, err := ds.conn.Write(wire); err != nil {
+		ds.disconnect()
 		return fmt.Errorf("failed to send data: %w", err)
 	}
 
+	ds.deltas.Commit()
+
+	ds.updateStats(func(stats *SendStats) {
+		stats.FramesSent++
+		stats.RawBytes += uint64(len(jsonData))
+		stats.WireBytes += uint64(len(wire))
+	})
 	return nil
 }
 
-func (ds *DataSender) IsConnected() bool {
-	return ds.connected && ds.conn != nil
-}
+func (ds *DataSender) compress(data []byte) ([]byte, error) {
+	ds.gzipBuffer.Reset()
+	if ds.gzipWriter == nil {
+		ds.gzipWriter = gzip.NewWriter(&ds.gzipBuffer)
+	} else {
+		ds.gzipWriter.Reset(&ds.gzipBuffer)
+	}
 
-func (ds *DataSender) Close() error {
-	if ds.conn != nil {
-		err := ds.conn.Close()
-		ds.conn = nil
-		ds.connected = false
-		return err
+	if _, err := ds.gzipWriter.Write(data); err != nil {
+		return nil, err
 	}
-	return nil
+	if err := ds.gzipWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	return ds.gzipBuffer.Bytes(), nil
 }
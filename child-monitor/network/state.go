@@ -0,0 +1,94 @@
+package network
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// ConnState is where the sender is in its connection lifecycle.
+type ConnState int
+
+const (
+	StateDisconnected ConnState = iota
+	StateConnecting
+	StateConnected
+	StateBackingOff
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateBackingOff:
+		return "backing off"
+	default:
+		return "unknown"
+	}
+}
+
+type EventKind int
+
+const (
+	EventStateChanged EventKind = iota
+	EventSent
+	EventSendFailed
+	EventServerError
+)
+
+// Event reports what the sender's background loop is doing. Retry is set
+// when State is StateBackingOff.
+type Event struct {
+	Kind  EventKind
+	State ConnState
+	Seq   uint64
+	Err   error
+	Retry time.Duration
+}
+
+// Backoff is an exponential reconnect delay. Jitter is the fraction of the
+// delay that is randomised, so 0.5 waits between 50% and 100% of it.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+func (b Backoff) Delay(attempt int) time.Duration {
+	delay := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if delay > float64(b.Max) || math.IsInf(delay, 1) {
+		delay = float64(b.Max)
+	}
+
+	jitter := math.Min(math.Max(b.Jitter, 0), 1)
+	delay -= delay * jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+type Options struct {
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	KeepAlive    time.Duration
+	QueueSize    int
+	Backoff      Backoff
+}
+
+func DefaultOptions() Options {
+	return Options{
+		DialTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		KeepAlive:    30 * time.Second,
+		QueueSize:    64,
+		Backoff: Backoff{
+			Initial:    time.Second,
+			Max:        2 * time.Minute,
+			Multiplier: 2,
+			Jitter:     0.5,
+		},
+	}
+}
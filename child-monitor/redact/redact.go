@@ -0,0 +1,292 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Replacement is written in place of every redacted secret.
+const Replacement = "[REDACTED]"
+
+// secretGroup is the capture group that marks the part of a match to
+// redact, e.g. only the value of a password=value pair.
+const secretGroup = "secret"
+
+type detector struct {
+	name    string
+	pattern *regexp.Regexp
+	secret  int
+}
+
+// builtins are always applied, before any patterns from the config.
+var builtins = []struct {
+	name    string
+	pattern string
+}{
+	{"private-key", `(?s)-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----.*?(-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----|\z)`},
+	// NOTE: The BEGIN line may have scrolled off, the base64 lines of key width and PEM headers right above an END line are the key
+	{"private-key-tail", `(?m)^(?:(?:Proc-Type|DEK-Info):[^\n]*\n\n?)*(?:[A-Za-z0-9+/=]{16,}\n)+(?:[A-Za-z0-9+/=]{1,15}\n)?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`},
+	{"aws-access-key", `\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`},
+	{"aws-secret-key", `(?i)aws_?secret_?(?:access_?)?key["']?[ \t]*[=:][ \t]*["']?(?P<secret>[A-Za-z0-9/+=]{40})`},
+	{"jwt", `\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]+`},
+	{"bearer-token", `(?i)\b(?:bearer|basic)[ \t]+(?P<secret>[A-Za-z0-9._~+/-]{8,}=*)`},
+	{"url-password", `\b[a-zA-Z][a-zA-Z0-9+.-]*://[^:/\s@]+:(?P<secret>[^@\s/]+)@`},
+	{"password-pair", `(?i)(?:password|passwd|secret|token|api[_-]?key)[A-Za-z0-9_-]*["']?[ \t]*[=:][ \t]*(?P<secret>"[^"\n]*"|'[^'\n]*'|[^\s"'&;,]+)`},
+}
+
+// Redactor replaces secrets in pane content with Replacement. Matching is
+// done on the text with ANSI escape sequences taken out, so colour codes
+// can neither hide a secret nor get cut in half by a replacement.
+type Redactor struct {
+	detectors []detector
+}
+
+// New returns a Redactor with the built-in detectors plus patterns. A
+// pattern with a group named "secret" only redacts that group.
+func New(patterns []string) (*Redactor, error) {
+	redactor := &Redactor{}
+
+	for _, builtin := range builtins {
+		redactor.add(builtin.name, regexp.MustCompile(builtin.pattern))
+	}
+	for _, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		redactor.add("custom", compiled)
+	}
+
+	return redactor, nil
+}
+
+func (r *Redactor) add(name string, pattern *regexp.Regexp) {
+	r.detectors = append(r.detectors, detector{
+		name:    name,
+		pattern: pattern,
+		secret:  pattern.SubexpIndex(secretGroup),
+	})
+}
+
+// Detectors returns the names of the patterns applied, "custom" for the
+// ones from the config.
+func (r *Redactor) Detectors() []string {
+	names := make([]string, len(r.detectors))
+	for i, d := range r.detectors {
+		names[i] = d.name
+	}
+	return names
+}
+
+type span struct {
+	start, end int
+}
+
+// Redact returns content with every secret replaced. Escape sequences and
+// line breaks inside a secret are kept, so styling and the number of lines
+// on screen stay the same. The payloads of OSC and other string sequences,
+// e.g. hyperlink URIs, are redacted on their own.
+func (r *Redactor) Redact(content string) string {
+	if r == nil || content == "" {
+		return content
+	}
+
+	content = r.redactStrings(content)
+	plain, offsets := stripANSI(content)
+
+	spans := r.find(plain)
+	if len(spans) == 0 {
+		return content
+	}
+	return replace(content, offsets, spans)
+}
+
+// RedactJoined redacts above and below as one text, for scrollback and the
+// screen under it, so a secret crossing from one into the other is found.
+func (r *Redactor) RedactJoined(above, below string) (string, string) {
+	if r == nil || above == "" {
+		return above, r.Redact(below)
+	}
+
+	separator := ""
+	if !strings.HasSuffix(above, "\n") {
+		separator = "\n"
+	}
+	joined := r.Redact(above + separator + below)
+
+	// NOTE: Redact keeps every line break, so the boundary is after the same number of them
+	split := 0
+	for n := strings.Count(above+separator, "\n"); n > 0; n-- {
+		split += strings.IndexByte(joined[split:], '\n') + 1
+	}
+	return strings.TrimSuffix(joined[:split], separator), joined[split:]
+}
+
+// find returns the spans of plain matched by any detector, merged.
+func (r *Redactor) find(plain string) []span {
+	var spans []span
+	for _, d := range r.detectors {
+		for _, match := range d.pattern.FindAllStringSubmatchIndex(plain, -1) {
+			start, end := match[0], match[1]
+			if d.secret > 0 && match[2*d.secret] >= 0 {
+				start, end = match[2*d.secret], match[2*d.secret+1]
+			}
+			if start < end {
+				spans = append(spans, span{start, end})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return merge(spans)
+}
+
+// redactStrings redacts the payload of every OSC, DCS, APC, PM and SOS
+// sequence in content, which stripANSI leaves out of the text matched.
+func (r *Redactor) redactStrings(content string) string {
+	if !strings.Contains(content, "\x1b") {
+		return content
+	}
+
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(content); i++ {
+		if content[i] != '\x1b' {
+			continue
+		}
+		n := escapeLength(content[i:])
+		if n > 2 && strings.IndexByte("]P_^X", content[i+1]) >= 0 {
+			start, end := i+2, i+n
+			switch {
+			case content[end-1] == '\a':
+				end--
+			case strings.HasSuffix(content[:end], "\x1b\\"):
+				end -= 2
+			}
+			payload := content[start:end]
+			if spans := r.find(payload); len(spans) > 0 {
+				b.WriteString(content[last:start])
+				b.WriteString(replace(payload, nil, spans))
+				last = end
+			}
+		}
+		i += n - 1
+	}
+	if last == 0 {
+		return content
+	}
+
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+// merge sorts spans and joins the ones that overlap.
+func merge(spans []span) []span {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.start <= last.end {
+			last.end = max(last.end, s.end)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// replace rewrites content, where plain byte i is content[offsets[i]], or
+// content[i] if offsets is nil.
+func replace(content string, offsets []int, spans []span) string {
+	var b strings.Builder
+	b.Grow(len(content))
+
+	p := 0
+	current := 0
+	for i := 0; i < len(content); i++ {
+		isPlain := offsets == nil || (p < len(offsets) && offsets[p] == i)
+		if !isPlain {
+			b.WriteByte(content[i])
+			continue
+		}
+
+		for current < len(spans) && spans[current].end <= p {
+			current++
+		}
+		switch {
+		case current >= len(spans) || p < spans[current].start:
+			b.WriteByte(content[i])
+		case p == spans[current].start:
+			b.WriteString(Replacement)
+			if content[i] == '\n' {
+				b.WriteByte('\n')
+			}
+		case content[i] == '\n':
+			b.WriteByte('\n')
+		}
+		p++
+	}
+	return b.String()
+}
+
+// stripANSI removes escape sequences from content. offsets maps every byte
+// of the result to its index in content; it is nil if nothing was removed.
+func stripANSI(content string) (string, []int) {
+	if !strings.Contains(content, "\x1b") {
+		return content, nil
+	}
+
+	var plain strings.Builder
+	plain.Grow(len(content))
+	offsets := make([]int, 0, len(content))
+
+	for i := 0; i < len(content); i++ {
+		if content[i] != '\x1b' {
+			plain.WriteByte(content[i])
+			offsets = append(offsets, i)
+			continue
+		}
+		i += escapeLength(content[i:]) - 1
+	}
+
+	return plain.String(), offsets
+}
+
+// escapeLength returns the length of the escape sequence at the start of s,
+// which begins with ESC: CSI sequences up to their final byte, OSC and other
+// string sequences up to BEL or ST, and two byte sequences otherwise.
+func escapeLength(s string) int {
+	if len(s) < 2 {
+		return len(s)
+	}
+
+	switch s[1] {
+	case '[':
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(s)
+	case ']', 'P', '_', '^', 'X':
+		for i := 2; i < len(s); i++ {
+			if s[i] == '\a' {
+				return i + 1
+			}
+			if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	case '(', ')', '*', '+', '#', '%':
+		return min(3, len(s))
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,210 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileSuffix = ".json"
+
+// Spool keeps samples that could not be sent on disk, one file per sample,
+// named by the time they were spooled so they replay in order. It is
+// bounded by total size and by age; the oldest samples go first. The files
+// are indexed in memory, the directory is only read by Open.
+type Spool struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+	lastName string
+	entries  []entry
+	size     int64
+	mutex    sync.Mutex
+}
+
+type entry struct {
+	name    string
+	size    int64
+	spooled time.Time
+}
+
+// Open indexes the samples already spooled in dir, e.g. by a previous run.
+func Open(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	// NOTE: Spooled samples hold pane content, a directory from an older version may still be world readable
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict spool directory: %w", err)
+	}
+
+	entries, err := readEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		entries:  entries,
+	}
+	for _, e := range entries {
+		s.size += e.size
+	}
+	if len(entries) > 0 {
+		s.lastName = entries[len(entries)-1].name
+	}
+	return s, nil
+}
+
+func (s *Spool) Dir() string {
+	return s.dir
+}
+
+// Append stores payload and trims the spool back within its limits.
+func (s *Spool) Append(payload []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	name := s.nextName(time.Now())
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+	if err := os.WriteFile(tmpPath, payload, 0600); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to commit spool file: %w", err)
+	}
+
+	s.entries = append(s.entries, entry{name: name, size: int64(len(payload)), spooled: spooledAt(name)})
+	s.size += int64(len(payload))
+
+	return s.trim()
+}
+
+// Replay hands spooled samples to send, oldest first, deleting each one
+// send accepts. It stops at the first error and leaves the rest in place.
+// The lock is not held while sending, so Append never waits on the network.
+func (s *Spool) Replay(send func(payload []byte) error) (int, error) {
+	s.mutex.Lock()
+	err := s.trim()
+	entries := append([]entry(nil), s.entries...)
+	s.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, e := range entries {
+		path := filepath.Join(s.dir, e.name)
+		payload, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue // NOTE: Trimmed by a concurrent Append
+		}
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read spool file: %w", err)
+		}
+
+		if err := send(payload); err != nil {
+			return replayed, err
+		}
+
+		s.mutex.Lock()
+		os.Remove(path)
+		// NOTE: Samples replay oldest first, so unless a concurrent Append trimmed it this one is at the front
+		if len(s.entries) > 0 && s.entries[0].name == e.name {
+			s.size -= s.entries[0].size
+			s.entries = s.entries[1:]
+		}
+		s.mutex.Unlock()
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// Stats returns the number of spooled samples and their total size.
+func (s *Spool) Stats() (int, int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.entries), s.size
+}
+
+func (s *Spool) nextName(now time.Time) string {
+	name := fmt.Sprintf("%020d%s", now.UnixNano(), fileSuffix)
+	// NOTE: Keep names strictly increasing even if the clock stalls or steps back
+	if name <= s.lastName {
+		name = fmt.Sprintf("%020d%s", spooledAt(s.lastName).UnixNano()+1, fileSuffix)
+	}
+	s.lastName = name
+	return name
+}
+
+// spooledAt parses the time a file name was given, zero if it isn't one.
+func spooledAt(name string) time.Time {
+	var nanos int64
+	if _, err := fmt.Sscanf(strings.TrimSuffix(name, fileSuffix), "%d", &nanos); err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func readEntries(dir string) ([]entry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var entries []entry
+	for _, d := range dirEntries {
+		if d.IsDir() || !strings.HasSuffix(d.Name(), fileSuffix) {
+			continue
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			continue
+		}
+
+		spooled := spooledAt(d.Name())
+		if spooled.IsZero() {
+			continue
+		}
+
+		entries = append(entries, entry{
+			name:    d.Name(),
+			size:    info.Size(),
+			spooled: spooled,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries, nil
+}
+
+func (s *Spool) trim() error {
+	cutoff := time.Now().Add(-s.maxAge)
+	for len(s.entries) > 0 {
+		e := s.entries[0]
+		expired := s.maxAge > 0 && e.spooled.Before(cutoff)
+		oversized := s.maxBytes > 0 && s.size > s.maxBytes
+		if !expired && !oversized {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, e.name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to trim spool: %w", err)
+		}
+		s.size -= e.size
+		s.entries = s.entries[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package spool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func replayAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+
+	var payloads []string
+	if _, err := s.Replay(func(payload []byte) error {
+		payloads = append(payloads, string(payload))
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	return payloads
+}
+
+func TestSpool(t *testing.T) {
+	old := fmt.Sprintf("%020d%s", time.Now().Add(-time.Hour).UnixNano(), fileSuffix)
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		maxAge   time.Duration
+		existing map[string]string
+		appends  []string
+		want     []string
+	}{
+		{
+			name:    "replays in order",
+			appends: []string{"one", "two", "three"},
+			want:    []string{"one", "two", "three"},
+		},
+		{
+			name:     "oldest go first over the size limit",
+			maxBytes: 10,
+			appends:  []string{"aaaa", "bbbb", "cccc", "dddd"},
+			want:     []string{"cccc", "dddd"},
+		},
+		{
+			name:     "expired samples are dropped",
+			maxAge:   time.Minute,
+			existing: map[string]string{old: "stale"},
+			appends:  []string{"fresh"},
+			want:     []string{"fresh"},
+		},
+		{
+			name:     "samples from a previous run come first",
+			existing: map[string]string{old: "before restart"},
+			appends:  []string{"after restart"},
+			want:     []string{"before restart", "after restart"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, payload := range tt.existing {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(payload), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			s, err := Open(dir, tt.maxBytes, tt.maxAge)
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			for _, payload := range tt.appends {
+				if err := s.Append([]byte(payload)); err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+			}
+
+			count, size := s.Stats()
+			var wantSize int64
+			for _, payload := range tt.want {
+				wantSize += int64(len(payload))
+			}
+			if count != len(tt.want) || size != wantSize {
+				t.Errorf("Stats = %d, %d, want %d, %d", count, size, len(tt.want), wantSize)
+			}
+
+			if got := replayAll(t, s); !slices.Equal(got, tt.want) {
+				t.Errorf("Replay = %q, want %q", got, tt.want)
+			}
+			if count, size := s.Stats(); count != 0 || size != 0 {
+				t.Errorf("Stats after replay = %d, %d, want empty", count, size)
+			}
+		})
+	}
+}
+
+func TestSpoolReplayStopsAtError(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, payload := range []string{"one", "two", "three"} {
+		s.Append([]byte(payload))
+	}
+
+	errOffline := errors.New("offline")
+	replayed, err := s.Replay(func(payload []byte) error {
+		if string(payload) == "two" {
+			return errOffline
+		}
+		return nil
+	})
+	if replayed != 1 || !errors.Is(err, errOffline) {
+		t.Fatalf("Replay = %d, %v, want 1 and the send error", replayed, err)
+	}
+
+	reopened, err := Open(s.Dir(), 0, 0)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got := replayAll(t, reopened); !slices.Equal(got, []string{"two", "three"}) {
+		t.Errorf("after a failed replay = %q, want [two three]", got)
+	}
+}
@@ -0,0 +1,179 @@
+package tmux
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Backend is everything the agent and the pickers need from tmux.
+// ExecBackend runs the tmux binary, FakeBackend is an in-memory stand-in
+// for tests.
+type Backend interface {
+	IsRunning() bool
+	GetSessions() ([]Session, error)
+	GetWindows(sessionID string) ([]Window, error)
+	GetAllWindows() ([]Window, error)
+	GetPanes(sessionID, windowID string) ([]Pane, error)
+	GetAllPanes() ([]Pane, error)
+	GetPaneContent(sessionID, windowID, paneID string) (string, error)
+	GetPaneScrollback(sessionID, windowID, paneID string, lines int) (string, error)
+}
+
+// DefaultSocket is the socket tmux uses without -L or -S.
+const DefaultSocket = "default"
+
+// ExecBackend shells out to the tmux binary on PATH for every call. Socket
+// is a socket name as for tmux -L, or a path as for tmux -S; empty means
+// the default socket.
+type ExecBackend struct {
+	Socket string
+}
+
+// NewExecBackend returns a backend for the tmux servers on sockets, or for
+// the default server if none are given.
+func NewExecBackend(sockets ...string) Backend {
+	if len(sockets) <= 1 {
+		var socket string
+		if len(sockets) == 1 {
+			socket = sockets[0]
+		}
+		return ExecBackend{Socket: socket}
+	}
+
+	backends := make(map[string]Backend, len(sockets))
+	for _, socket := range sockets {
+		backends[NormalizeSocket(socket)] = ExecBackend{Socket: socket}
+	}
+	return NewMultiBackend(backends)
+}
+
+// NormalizeSocket maps the default socket to "", which is how sessions,
+// windows and panes on it are tagged.
+func NormalizeSocket(socket string) string {
+	if socket == DefaultSocket {
+		return ""
+	}
+	return socket
+}
+
+// QualifyID prefixes a tmux ID with its socket, so that the same %1 on two
+// servers doesn't collide. IDs on the default socket stay as tmux prints
+// them.
+func QualifyID(socket, id string) string {
+	socket = NormalizeSocket(socket)
+	if socket == "" || id == "" {
+		return id
+	}
+	return socket + "/" + id
+}
+
+// SplitID returns the socket and the plain tmux ID of a qualified ID.
+func SplitID(id string) (string, string) {
+	i := strings.LastIndex(id, "/")
+	if i < 0 {
+		return "", id
+	}
+	return id[:i], id[i+1:]
+}
+
+// MultiBackend combines the tmux servers behind several backends, keyed by
+// socket, into one. Calls taking an ID go to the backend its socket names.
+type MultiBackend struct {
+	sockets  []string
+	backends map[string]Backend
+}
+
+func NewMultiBackend(backends map[string]Backend) *MultiBackend {
+	multi := &MultiBackend{backends: backends}
+	for socket := range backends {
+		multi.sockets = append(multi.sockets, socket)
+	}
+	sort.Strings(multi.sockets)
+	return multi
+}
+
+func (m *MultiBackend) backend(id string) (Backend, error) {
+	socket, _ := SplitID(id)
+	backend, ok := m.backends[socket]
+	if !ok {
+		return nil, fmt.Errorf("no tmux socket %q configured", socket)
+	}
+	return backend, nil
+}
+
+func (m *MultiBackend) IsRunning() bool {
+	for _, socket := range m.sockets {
+		if m.backends[socket].IsRunning() {
+			return true
+		}
+	}
+	return false
+}
+
+// collect concatenates list results from every socket. A socket without a
+// running server is skipped, it only fails if all of them do.
+func collect[T any](m *MultiBackend, list func(Backend) ([]T, error)) ([]T, error) {
+	var all []T
+	var lastErr error
+	failed := 0
+
+	for _, socket := range m.sockets {
+		items, err := list(m.backends[socket])
+		if err != nil {
+			lastErr = err
+			failed++
+			continue
+		}
+		all = append(all, items...)
+	}
+
+	if failed == len(m.sockets) && lastErr != nil {
+		return nil, lastErr
+	}
+	return all, nil
+}
+
+func (m *MultiBackend) GetSessions() ([]Session, error) {
+	return collect(m, Backend.GetSessions)
+}
+
+func (m *MultiBackend) GetWindows(sessionID string) ([]Window, error) {
+	backend, err := m.backend(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetWindows(sessionID)
+}
+
+func (m *MultiBackend) GetAllWindows() ([]Window, error) {
+	return collect(m, Backend.GetAllWindows)
+}
+
+func (m *MultiBackend) GetPanes(sessionID, windowID string) ([]Pane, error) {
+	backend, err := m.backend(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetPanes(sessionID, windowID)
+}
+
+func (m *MultiBackend) GetAllPanes() ([]Pane, error) {
+	return collect(m, Backend.GetAllPanes)
+}
+
+func (m *MultiBackend) GetPaneContent(sessionID, windowID, paneID string) (string, error) {
+	backend, err := m.backend(paneID)
+	if err != nil {
+		return "", err
+	}
+	return backend.GetPaneContent(sessionID, windowID, paneID)
+}
+
+func (m *MultiBackend) GetPaneScrollback(sessionID, windowID, paneID string, lines int) (string, error) {
+	backend, err := m.backend(paneID)
+	if err != nil {
+		return "", err
+	}
+	return backend.GetPaneScrollback(sessionID, windowID, paneID, lines)
+}
@@ -0,0 +1,268 @@
+package tmux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+var errControlClosed = errors.New("control client closed")
+
+// Notification is one asynchronous line from a control mode client, e.g.
+// %output or %layout-change. Name is without the leading %.
+type Notification struct {
+	Name     string
+	PaneID   string
+	WindowID string
+	Data     string
+	// Seq numbers notifications in the order tmux sent them, see
+	// ControlClient.command
+	Seq uint64
+}
+
+// commandResult is a command's reply, seq being the Seq of the last
+// notification read before it.
+type commandResult struct {
+	lines []string
+	err   error
+	seq   uint64
+}
+
+// ControlClient is a tmux control mode client (tmux -C) attached to one
+// session. tmux streams notifications for the session's panes on stdout and
+// answers commands written to stdin in %begin/%end blocks, in order.
+type ControlClient struct {
+	backend   ExecBackend
+	sessionID string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	notify    func(Notification)
+	// notified is only used by the reader goroutine
+	notified uint64
+
+	mutex   sync.Mutex
+	pending []chan commandResult
+	done    chan struct{}
+	err     error
+}
+
+// NewControlClient attaches to sessionID on the backend's socket. The client
+// is read-only and ignored for window sizing, so it never resizes what users
+// see. notify is called from the reader goroutine for every notification,
+// with IDs qualified like the backend's.
+func NewControlClient(backend ExecBackend, sessionID string, notify func(Notification)) (*ControlClient, error) {
+	cmd := backend.command("-C", "attach-session", "-f", "ignore-size,read-only", "-t", target(sessionID))
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start control client: %w", err)
+	}
+
+	client := &ControlClient{
+		backend:   backend,
+		sessionID: sessionID,
+		cmd:       cmd,
+		stdin:     stdin,
+		notify:    notify,
+		done:      make(chan struct{}),
+	}
+	go client.read(stdout)
+
+	return client, nil
+}
+
+// Done is closed when the client exits, e.g. because the session closed.
+func (c *ControlClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *ControlClient) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Command runs a tmux command over the control connection and returns its
+// output lines.
+func (c *ControlClient) Command(args ...string) ([]string, error) {
+	result := c.command(args...)
+	return result.lines, result.err
+}
+
+// command is Command keeping the reply's place among notifications, which
+// tmux sends in order with replies: output notified up to result.seq
+// happened before the command ran.
+func (c *ControlClient) command(args ...string) commandResult {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+
+	result := make(chan commandResult, 1)
+
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return commandResult{err: c.err}
+	}
+	// NOTE: Replies come back in the order commands were written, so queue and write under one lock
+	c.pending = append(c.pending, result)
+	_, err := io.WriteString(c.stdin, strings.Join(quoted, " ")+"\n")
+	c.mutex.Unlock()
+	if err != nil {
+		return commandResult{err: fmt.Errorf("failed to write control command: %w", err)}
+	}
+
+	select {
+	case reply := <-result:
+		return reply
+	case <-c.done:
+		return commandResult{err: c.Err()}
+	}
+}
+
+// Close detaches the client. tmux exits on its own once stdin is closed.
+func (c *ControlClient) Close() error {
+	c.stdin.Close()
+	<-c.done
+	return nil
+}
+
+func (c *ControlClient) read(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+
+	var block []string
+	var blockNumber string
+	var ownBlock, inBlock bool
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			c.finish(fmt.Errorf("control client for %s exited: %w", c.sessionID, err))
+			return
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		if inBlock {
+			fields := strings.Fields(line)
+			// NOTE: Output lines may start with %end too, only the matching command number closes the block
+			if len(fields) >= 3 && (fields[0] == "%end" || fields[0] == "%error") && fields[2] == blockNumber {
+				inBlock = false
+				if ownBlock {
+					result := commandResult{lines: block}
+					if fields[0] == "%error" {
+						result = commandResult{err: errors.New(strings.Join(block, "; "))}
+					}
+					c.reply(result)
+				}
+				block = nil
+				continue
+			}
+			block = append(block, line)
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 4)
+		switch fields[0] {
+		case "%begin":
+			// NOTE: Flag 1 marks replies to our own commands, the attach itself also gets a block
+			if len(fields) >= 4 {
+				inBlock, blockNumber, ownBlock = true, fields[2], fields[3] == "1"
+			}
+		case "%output":
+			if len(fields) >= 2 {
+				data := strings.TrimPrefix(line, fields[0]+" "+fields[1]+" ")
+				c.emit(Notification{Name: "output", PaneID: QualifyID(c.backend.Socket, fields[1]), Data: unescapeOutput(data)})
+			}
+		case "%exit":
+			c.emit(Notification{Name: "exit"})
+		default:
+			if strings.HasPrefix(fields[0], "%") {
+				notification := Notification{Name: strings.TrimPrefix(fields[0], "%")}
+				if len(fields) >= 2 && strings.HasPrefix(fields[1], "@") {
+					notification.WindowID = QualifyID(c.backend.Socket, fields[1])
+				}
+				if len(fields) >= 3 {
+					notification.Data = fields[2]
+				}
+				c.emit(notification)
+			}
+		}
+	}
+}
+
+func (c *ControlClient) emit(notification Notification) {
+	c.notified++
+	notification.Seq = c.notified
+	c.notify(notification)
+}
+
+func (c *ControlClient) reply(result commandResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.pending) == 0 {
+		return
+	}
+	result.seq = c.notified
+	c.pending[0] <- result
+	c.pending = c.pending[1:]
+}
+
+func (c *ControlClient) finish(err error) {
+	c.cmd.Wait()
+
+	c.mutex.Lock()
+	if c.err == nil {
+		c.err = errControlClosed
+		if !errors.Is(err, io.EOF) {
+			c.err = err
+		}
+	}
+	c.pending = nil
+	c.mutex.Unlock()
+
+	close(c.done)
+}
+
+// unescapeOutput decodes %output data, where tmux writes bytes below 32
+// and backslashes as \ooo octal escapes.
+func unescapeOutput(data string) string {
+	if !strings.Contains(data, "\\") {
+		return data
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '\\' && i+3 < len(data) && isOctal(data[i+1]) && isOctal(data[i+2]) && isOctal(data[i+3]) {
+			b.WriteByte((data[i+1]-'0')<<6 | (data[i+2]-'0')<<3 | (data[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(data[i])
+	}
+	return b.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+// quoteArg quotes a command argument for the control mode command parser.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t'\"\\;#$~{}") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
@@ -0,0 +1,283 @@
+package tmux
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FakeBackend is an in-memory tmux server for tests. Sessions, windows and
+// panes are listed in the order they were added, like tmux does.
+type FakeBackend struct {
+	mutex      sync.Mutex
+	socket     string
+	stopped    bool
+	sessions   []Session
+	windows    []Window
+	panes      []Pane
+	content    map[string]string
+	scrollback map[string]string
+	captures   map[string]int
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		content:    make(map[string]string),
+		scrollback: make(map[string]string),
+		captures:   make(map[string]int),
+	}
+}
+
+// SetSocket makes the fake a server on a named socket. IDs passed in
+// afterwards are qualified with it, like ExecBackend does.
+func (f *FakeBackend) SetSocket(socket string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.socket = NormalizeSocket(socket)
+}
+
+func (f *FakeBackend) qualify(id string) string {
+	if socket, _ := SplitID(id); socket != "" {
+		return id
+	}
+	return QualifyID(f.socket, id)
+}
+
+func (f *FakeBackend) AddSession(id, name string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.sessions = append(f.sessions, Session{ID: f.qualify(id), Name: name, Socket: f.socket})
+}
+
+func (f *FakeBackend) AddWindow(window Window) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	window.ID = f.qualify(window.ID)
+	window.SessionID = f.qualify(window.SessionID)
+	window.Socket = f.socket
+	f.windows = append(f.windows, window)
+}
+
+// AddPane adds a pane to an existing window, filling in the session and
+// window names.
+func (f *FakeBackend) AddPane(pane Pane) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	pane.ID = f.qualify(pane.ID)
+	pane.WindowID = f.qualify(pane.WindowID)
+	pane.Socket = f.socket
+	for _, window := range f.windows {
+		if window.ID == pane.WindowID {
+			pane.SessionID = window.SessionID
+			pane.WindowName = window.Name
+		}
+	}
+	for _, session := range f.sessions {
+		if session.ID == pane.SessionID {
+			pane.SessionName = session.Name
+		}
+	}
+	f.panes = append(f.panes, pane)
+}
+
+// UpdatePane replaces a pane's metadata, e.g. to change its command.
+func (f *FakeBackend) UpdatePane(pane Pane) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	pane.ID = f.qualify(pane.ID)
+	for i := range f.panes {
+		if f.panes[i].ID == pane.ID {
+			f.panes[i] = pane
+		}
+	}
+}
+
+// RemovePane closes a pane, and its window with it if it was the last one.
+func (f *FakeBackend) RemovePane(paneID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	paneID = f.qualify(paneID)
+	var windowID string
+	for i := range f.panes {
+		if f.panes[i].ID == paneID {
+			windowID = f.panes[i].WindowID
+			f.panes = append(f.panes[:i], f.panes[i+1:]...)
+			break
+		}
+	}
+	delete(f.content, paneID)
+	delete(f.scrollback, paneID)
+
+	for _, pane := range f.panes {
+		if pane.WindowID == windowID {
+			return
+		}
+	}
+	for i := range f.windows {
+		if f.windows[i].ID == windowID {
+			f.windows = append(f.windows[:i], f.windows[i+1:]...)
+			break
+		}
+	}
+}
+
+func (f *FakeBackend) SetContent(paneID, content string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.content[f.qualify(paneID)] = content
+}
+
+func (f *FakeBackend) SetScrollback(paneID, scrollback string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.scrollback[f.qualify(paneID)] = scrollback
+}
+
+// Stop makes the fake behave like a tmux server that isn't running.
+func (f *FakeBackend) Stop() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.stopped = true
+}
+
+// Captures returns how often a pane's content was captured.
+func (f *FakeBackend) Captures(paneID string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.captures[f.qualify(paneID)]
+}
+
+func (f *FakeBackend) IsRunning() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return !f.stopped && len(f.sessions) > 0
+}
+
+func (f *FakeBackend) GetSessions() ([]Session, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stopped {
+		return nil, fmt.Errorf("failed to list sessions: no server running")
+	}
+	return append([]Session(nil), f.sessions...), nil
+}
+
+func (f *FakeBackend) GetWindows(sessionID string) ([]Window, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.hasSession(sessionID) {
+		return nil, fmt.Errorf("failed to list windows: can't find session %s", sessionID)
+	}
+
+	var windows []Window
+	for _, window := range f.windows {
+		if window.SessionID == sessionID {
+			windows = append(windows, window)
+		}
+	}
+	return windows, nil
+}
+
+func (f *FakeBackend) GetAllWindows() ([]Window, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stopped {
+		return nil, fmt.Errorf("failed to list windows: no server running")
+	}
+	return append([]Window(nil), f.windows...), nil
+}
+
+func (f *FakeBackend) GetPanes(sessionID, windowID string) ([]Pane, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.hasSession(sessionID) {
+		return nil, fmt.Errorf("failed to list panes: can't find session %s", sessionID)
+	}
+
+	var panes []Pane
+	for _, pane := range f.panes {
+		if pane.SessionID == sessionID && pane.WindowID == windowID {
+			panes = append(panes, pane)
+		}
+	}
+	if len(panes) == 0 {
+		return nil, fmt.Errorf("failed to list panes: can't find window %s", windowID)
+	}
+	return panes, nil
+}
+
+func (f *FakeBackend) GetAllPanes() ([]Pane, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stopped {
+		return nil, fmt.Errorf("failed to list panes: no server running")
+	}
+	return append([]Pane(nil), f.panes...), nil
+}
+
+func (f *FakeBackend) GetPaneContent(sessionID, windowID, paneID string) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.hasPane(paneID) {
+		return "", fmt.Errorf("failed to capture pane: can't find pane %s", paneID)
+	}
+	f.captures[paneID]++
+	return f.content[paneID], nil
+}
+
+// GetPaneScrollback returns the last lines of the pane's scrollback.
+func (f *FakeBackend) GetPaneScrollback(sessionID, windowID, paneID string, lines int) (string, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !f.hasPane(paneID) {
+		return "", fmt.Errorf("failed to capture pane scrollback: can't find pane %s", paneID)
+	}
+
+	history := strings.Split(strings.TrimSuffix(f.scrollback[paneID], "\n"), "\n")
+	if len(history) > lines {
+		history = history[len(history)-lines:]
+	}
+	return strings.Join(history, "\n") + "\n", nil
+}
+
+func (f *FakeBackend) hasSession(sessionID string) bool {
+	if f.stopped {
+		return false
+	}
+	for _, session := range f.sessions {
+		if session.ID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FakeBackend) hasPane(paneID string) bool {
+	if f.stopped {
+		return false
+	}
+	for _, pane := range f.panes {
+		if pane.ID == paneID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+package tmux
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	PanesAll    = "all"
+	PanesActive = "active"
+)
+
+// PrivacyFull sends pane content, PrivacyMetadata only what runs in the pane,
+// its size and when it was last active, and PrivacyExclude leaves the pane
+// out entirely.
+const (
+	PrivacyFull     = "full"
+	PrivacyMetadata = "metadata"
+	PrivacyExclude  = "exclude"
+)
+
+// privacyLevels orders the policies, a pane matched by several rules gets
+// the strictest one.
+var privacyLevels = map[string]int{
+	"":              0,
+	PrivacyFull:     0,
+	PrivacyMetadata: 1,
+	PrivacyExclude:  2,
+}
+
+// Rule selects panes by session, window name and pane activity. Window is
+// a glob matched against the window name or ID, WindowRegex a regular
+// expression on the name; with neither set every window matches. Pane is a
+// glob on the pane index or ID. Scrollback is how many lines above the
+// visible screen to capture. Socket names the tmux server the session runs
+// on, empty for the default one. Privacy is one of the Privacy constants.
+type Rule struct {
+	Socket      string `json:"socket,omitempty"`
+	Session     string `json:"session"`
+	Window      string `json:"window,omitempty"`
+	WindowRegex string `json:"window_regex,omitempty"`
+	Pane        string `json:"pane,omitempty"`
+	Panes       string `json:"panes,omitempty"`
+	Scrollback  int    `json:"scrollback,omitempty"`
+	Privacy     string `json:"privacy,omitempty"`
+}
+
+func (r Rule) Validate() error {
+	if r.Session == "" {
+		return fmt.Errorf("rule is missing a session")
+	}
+	if r.Window != "" {
+		if _, err := path.Match(r.Window, ""); err != nil {
+			return fmt.Errorf("invalid window glob %q: %w", r.Window, err)
+		}
+	}
+	if r.WindowRegex != "" {
+		if _, err := regexp.Compile(r.WindowRegex); err != nil {
+			return fmt.Errorf("invalid window regex %q: %w", r.WindowRegex, err)
+		}
+	}
+	if r.Pane != "" {
+		if _, err := path.Match(r.Pane, ""); err != nil {
+			return fmt.Errorf("invalid pane glob %q: %w", r.Pane, err)
+		}
+	}
+	if r.Scrollback < 0 {
+		return fmt.Errorf("scrollback must not be negative")
+	}
+	switch r.Panes {
+	case "", PanesAll, PanesActive:
+	default:
+		return fmt.Errorf("invalid panes %q, expected %q or %q", r.Panes, PanesAll, PanesActive)
+	}
+	if _, ok := privacyLevels[r.Privacy]; !ok {
+		return fmt.Errorf("invalid privacy %q, expected %q, %q or %q", r.Privacy, PrivacyFull, PrivacyMetadata, PrivacyExclude)
+	}
+	return nil
+}
+
+// EscapeGlob quotes the glob metacharacters in name, for rules that must
+// match one window exactly.
+func EscapeGlob(name string) string {
+	var b strings.Builder
+	for _, c := range name {
+		if strings.ContainsRune(`*?[]\`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+type compiledRule struct {
+	Rule
+	windowRegex *regexp.Regexp
+}
+
+func (r compiledRule) matchesSession(session Session) bool {
+	if NormalizeSocket(r.Socket) != session.Socket {
+		return false
+	}
+	return r.Session == session.Name || r.Session == session.ID || QualifyID(r.Socket, r.Session) == session.ID
+}
+
+func (r compiledRule) matchesWindow(window Window) bool {
+	if r.Window != "" {
+		byName, _ := path.Match(r.Window, window.Name)
+		byID, _ := path.Match(r.Window, window.ID)
+		if !byName && !byID {
+			return false
+		}
+	}
+	if r.windowRegex != nil && !r.windowRegex.MatchString(window.Name) {
+		return false
+	}
+	return true
+}
+
+func (r compiledRule) matchesPane(pane Pane) bool {
+	if r.Panes == PanesActive && !pane.Active {
+		return false
+	}
+	if r.Pane != "" {
+		byIndex, _ := path.Match(r.Pane, strconv.Itoa(pane.Index))
+		byID, _ := path.Match(r.Pane, pane.ID)
+		if !byIndex && !byID {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver re-evaluates rules against the running tmux server and keeps
+// track of which panes came and went since the previous resolve.
+type Resolver struct {
+	backend  Backend
+	rules    []compiledRule
+	current  map[string]Pane
+	resolved bool
+}
+
+// Changes is the outcome of one resolve. Added and Removed are empty on the
+// first resolve, which only establishes the baseline.
+type Changes struct {
+	Panes   []Pane
+	Added   []Pane
+	Removed []Pane
+}
+
+func NewResolver(backend Backend, rules []Rule) (*Resolver, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no selection rules configured")
+	}
+
+	resolver := &Resolver{backend: backend, current: make(map[string]Pane)}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+
+		compiled := compiledRule{Rule: rule}
+		if rule.WindowRegex != "" {
+			compiled.windowRegex = regexp.MustCompile(rule.WindowRegex)
+		}
+		resolver.rules = append(resolver.rules, compiled)
+	}
+
+	return resolver, nil
+}
+
+// Resolve lists sessions, windows and panes and returns every pane matched
+// by at least one rule, in tmux order. A session that doesn't exist yet just
+// matches nothing. Scrollback comes from the first rule matching a pane,
+// privacy from the strictest, and excluded panes are left out.
+func (r *Resolver) Resolve() (Changes, error) {
+	sessions, err := r.backend.GetSessions()
+	if err != nil {
+		return Changes{}, err
+	}
+
+	var changes Changes
+	matched := make(map[string]Pane)
+
+	for _, session := range sessions {
+		var sessionRules []compiledRule
+		for _, rule := range r.rules {
+			if rule.matchesSession(session) {
+				sessionRules = append(sessionRules, rule)
+			}
+		}
+		if len(sessionRules) == 0 {
+			continue
+		}
+
+		windows, err := r.backend.GetWindows(session.ID)
+		if err != nil {
+			return Changes{}, err
+		}
+
+		for _, window := range windows {
+			var windowRules []compiledRule
+			for _, rule := range sessionRules {
+				if rule.matchesWindow(window) {
+					windowRules = append(windowRules, rule)
+				}
+			}
+			if len(windowRules) == 0 {
+				continue
+			}
+
+			panes, err := r.backend.GetPanes(session.ID, window.ID)
+			if err != nil {
+				// NOTE: The window may have closed since it was listed
+				continue
+			}
+
+			for _, pane := range panes {
+				if _, seen := matched[pane.ID]; seen {
+					continue
+				}
+
+				selected := false
+				for _, rule := range windowRules {
+					if !rule.matchesPane(pane) {
+						continue
+					}
+					if !selected {
+						selected = true
+						pane.Scrollback = rule.Scrollback
+					}
+					if privacyLevels[rule.Privacy] > privacyLevels[pane.Privacy] {
+						pane.Privacy = rule.Privacy
+					}
+				}
+				if !selected || pane.Privacy == PrivacyExclude {
+					continue
+				}
+
+				switch pane.Privacy {
+				case "":
+					pane.Privacy = PrivacyFull
+				case PrivacyMetadata:
+					pane.Scrollback = 0
+				}
+				pane.SessionName = session.Name
+				pane.WindowName = window.Name
+				matched[pane.ID] = pane
+				changes.Panes = append(changes.Panes, pane)
+			}
+		}
+	}
+
+	if r.resolved {
+		for _, pane := range changes.Panes {
+			if _, exists := r.current[pane.ID]; !exists {
+				changes.Added = append(changes.Added, pane)
+			}
+		}
+		for id, pane := range r.current {
+			if _, exists := matched[id]; !exists {
+				changes.Removed = append(changes.Removed, pane)
+			}
+		}
+		sort.Slice(changes.Removed, func(i, j int) bool {
+			return changes.Removed[i].ID < changes.Removed[j].ID
+		})
+	}
+
+	r.current = matched
+	r.resolved = true
+	return changes, nil
+}
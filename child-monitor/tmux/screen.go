@@ -0,0 +1,754 @@
+package tmux
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// screen is a terminal model of one pane, fed with what the pane printed as
+// reported by %output. It understands the cursor movement, erasing,
+// scrolling and alternate screen sequences full-screen programs use, keeps
+// colours and attributes, and moves lines scrolled off the top into a
+// bounded history, so nothing printed between two reads is lost.
+type screen struct {
+	width  int
+	height int
+	lines  []screenLine
+	main   []screenLine // the main screen's lines while the alternate one is shown
+
+	x, y      int
+	wrapNext  bool
+	autowrap  bool
+	alternate bool
+	top       int
+	bottom    int
+	pen       pen
+	saved     savedCursor
+	mainSaved savedCursor
+
+	history      []string
+	historyOpen  bool
+	historyLimit int
+
+	state   int
+	params  []byte
+	partial []byte
+}
+
+type screenLine struct {
+	cells []screenCell
+	// wrapped is set when the line continues on the next one
+	wrapped bool
+}
+
+// screenCell is one column. A blank cell has no char, the second column of
+// a wide character is a continuation.
+type screenCell struct {
+	char         string
+	style        string
+	continuation bool
+}
+
+type savedCursor struct {
+	x, y int
+	pen  pen
+}
+
+// pen is the current SGR state, fg and bg hold the colour parameters as sent.
+type pen struct {
+	attrs uint16
+	fg    string
+	bg    string
+}
+
+const (
+	stateGround = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+// maxParams bounds a CSI sequence, longer ones are dropped.
+const maxParams = 64
+
+func newScreen(width, height, historyLimit int) *screen {
+	s := &screen{
+		width:        max(width, 1),
+		height:       max(height, 1),
+		historyLimit: historyLimit,
+		autowrap:     true,
+	}
+	s.lines = s.blankLines()
+	s.bottom = s.height - 1
+	return s
+}
+
+func (s *screen) blankLines() []screenLine {
+	lines := make([]screenLine, s.height)
+	for i := range lines {
+		lines[i] = s.blankLine()
+	}
+	return lines
+}
+
+func (s *screen) blankLine() screenLine {
+	return screenLine{cells: make([]screenCell, s.width)}
+}
+
+// Alternate reports whether the alternate screen is shown.
+func (s *screen) Alternate() bool {
+	return s.alternate
+}
+
+// Write feeds output to the screen. Escape sequences and UTF-8 characters
+// may be split across writes.
+func (s *screen) Write(data string) {
+	for i := 0; i < len(data); i++ {
+		s.feed(data[i])
+	}
+}
+
+func (s *screen) feed(c byte) {
+	switch s.state {
+	case stateEscape:
+		s.escape(c)
+		return
+	case stateCharset:
+		s.state = stateGround
+		return
+	case stateString:
+		switch c {
+		case 0x07:
+			s.state = stateGround
+		case 0x1b:
+			s.state = stateStringEscape
+		}
+		return
+	case stateStringEscape:
+		// NOTE: ESC \ ends the string, any other ESC starts a new sequence
+		if c == '\\' {
+			s.state = stateGround
+			return
+		}
+		s.state = stateEscape
+		s.escape(c)
+		return
+	case stateCSI:
+		switch {
+		case c == 0x1b:
+			s.state = stateEscape
+		case c < 0x20:
+			s.control(c)
+		case c < 0x40:
+			if len(s.params) < maxParams {
+				s.params = append(s.params, c)
+			}
+		default:
+			s.state = stateGround
+			if len(s.params) < maxParams {
+				s.csi(c, string(s.params))
+			}
+		}
+		return
+	}
+
+	if len(s.partial) > 0 || c >= 0x80 {
+		s.partial = append(s.partial, c)
+		if !utf8.FullRune(s.partial) {
+			return
+		}
+		r, _ := utf8.DecodeRune(s.partial)
+		s.partial = s.partial[:0]
+		s.print(r)
+		return
+	}
+	if c < 0x20 || c == 0x7f {
+		s.control(c)
+		return
+	}
+	s.print(rune(c))
+}
+
+func (s *screen) control(c byte) {
+	switch c {
+	case 0x1b:
+		s.state = stateEscape
+	case '\r':
+		s.x, s.wrapNext = 0, false
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\b':
+		s.wrapNext = false
+		if s.x > 0 {
+			s.x--
+		}
+	case '\t':
+		s.wrapNext = false
+		s.x = min((s.x/8+1)*8, s.width-1)
+	}
+}
+
+func (s *screen) escape(c byte) {
+	s.state = stateGround
+	switch c {
+	case '[':
+		s.state, s.params = stateCSI, s.params[:0]
+	case ']', 'P', 'X', '^', '_':
+		s.state = stateString
+	case '(', ')', '*', '+', '-', '.', '/', '#', '%':
+		s.state = stateCharset
+	case '7':
+		s.saved = savedCursor{x: s.x, y: s.y, pen: s.pen}
+	case '8':
+		s.restoreCursor(s.saved)
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	}
+}
+
+func (s *screen) csi(final byte, raw string) {
+	private := ""
+	if raw != "" && strings.IndexByte("?<=>", raw[0]) >= 0 {
+		private, raw = raw[:1], raw[1:]
+	}
+	// NOTE: Sequences with intermediates, e.g. the cursor style, don't change the content
+	if strings.ContainsAny(raw, " !\"#$%&'()*+,-./") {
+		return
+	}
+	if final == 'm' {
+		if private == "" {
+			s.pen = s.pen.apply(raw)
+		}
+		return
+	}
+
+	params := parseParams(raw)
+	n := func(i, fallback int) int {
+		if i < len(params) && params[i] > 0 {
+			return params[i]
+		}
+		return fallback
+	}
+
+	if private == "?" {
+		if final == 'h' || final == 'l' {
+			for _, mode := range params {
+				s.setMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if private != "" {
+		return
+	}
+
+	s.wrapNext = false
+	switch final {
+	case '@':
+		s.insertCells(n(0, 1))
+	case 'A':
+		s.y = max(s.y-n(0, 1), s.regionTop())
+	case 'B', 'e':
+		s.y = min(s.y+n(0, 1), s.regionBottom())
+	case 'C', 'a':
+		s.x = min(s.x+n(0, 1), s.width-1)
+	case 'D':
+		s.x = max(s.x-n(0, 1), 0)
+	case 'E':
+		s.x, s.y = 0, min(s.y+n(0, 1), s.regionBottom())
+	case 'F':
+		s.x, s.y = 0, max(s.y-n(0, 1), s.regionTop())
+	case 'G', '`':
+		s.x = min(n(0, 1), s.width) - 1
+	case 'H', 'f':
+		s.y, s.x = min(n(0, 1), s.height)-1, min(n(1, 1), s.width)-1
+	case 'd':
+		s.y = min(n(0, 1), s.height) - 1
+	case 'J':
+		s.eraseDisplay(n(0, 0))
+	case 'K':
+		s.eraseLine(n(0, 0))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollDown(s.y, n(0, 1))
+			s.x = 0
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollUp(s.y, n(0, 1), false)
+			s.x = 0
+		}
+	case 'P':
+		s.deleteCells(n(0, 1))
+	case 'X':
+		s.erase(s.y, s.x, min(s.x+n(0, 1), s.width))
+	case 'S':
+		s.scrollUp(s.top, n(0, 1), true)
+	case 'T':
+		s.scrollDown(s.top, n(0, 1))
+	case 'r':
+		top, bottom := n(0, 1)-1, min(n(1, s.height), s.height)-1
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.saved = savedCursor{x: s.x, y: s.y, pen: s.pen}
+	case 'u':
+		s.restoreCursor(s.saved)
+	}
+}
+
+// parseParams reads ; separated CSI parameters, missing ones are 0.
+func parseParams(raw string) []int {
+	if raw == "" {
+		return nil
+	}
+	fields := strings.Split(raw, ";")
+	params := make([]int, len(fields))
+	for i, field := range fields {
+		field, _, _ = strings.Cut(field, ":")
+		params[i], _ = strconv.Atoi(field)
+	}
+	return params
+}
+
+func (s *screen) setMode(mode int, on bool) {
+	switch mode {
+	case 7:
+		s.autowrap = on
+	case 47, 1047, 1049:
+		if on {
+			s.enterAlternate(mode == 1049)
+		} else {
+			s.leaveAlternate(mode == 1049)
+		}
+	}
+}
+
+func (s *screen) enterAlternate(saveCursor bool) {
+	if s.alternate {
+		return
+	}
+	if saveCursor {
+		s.mainSaved = savedCursor{x: s.x, y: s.y, pen: s.pen}
+	}
+	s.main, s.lines = s.lines, s.blankLines()
+	s.alternate = true
+}
+
+func (s *screen) leaveAlternate(restoreCursor bool) {
+	if !s.alternate {
+		return
+	}
+	s.lines, s.main = s.main, nil
+	s.alternate = false
+	if restoreCursor {
+		s.restoreCursor(s.mainSaved)
+	}
+}
+
+func (s *screen) restoreCursor(saved savedCursor) {
+	s.x, s.y = min(saved.x, s.width-1), min(saved.y, s.height-1)
+	s.pen, s.wrapNext = saved.pen, false
+}
+
+func (s *screen) reset() {
+	s.lines, s.main = s.blankLines(), nil
+	s.alternate, s.autowrap, s.wrapNext = false, true, false
+	s.x, s.y, s.top, s.bottom = 0, 0, 0, s.height-1
+	s.pen, s.saved, s.mainSaved = pen{}, savedCursor{}, savedCursor{}
+}
+
+// regionTop and regionBottom bound vertical cursor movement, which stays
+// inside the scroll region when it starts there.
+func (s *screen) regionTop() int {
+	if s.y >= s.top {
+		return s.top
+	}
+	return 0
+}
+
+func (s *screen) regionBottom() int {
+	if s.y <= s.bottom {
+		return s.bottom
+	}
+	return s.height - 1
+}
+
+func (s *screen) print(r rune) {
+	width := runewidth.RuneWidth(r)
+	if width == 0 {
+		// NOTE: Combining characters join the cell before the cursor
+		x := s.x - 1
+		if s.wrapNext {
+			x = s.x
+		}
+		if x >= 0 && s.lines[s.y].cells[x].char != "" {
+			s.lines[s.y].cells[x].char += string(r)
+		}
+		return
+	}
+
+	if s.wrapNext || s.x+width > s.width {
+		if !s.autowrap {
+			s.x = max(s.width-width, 0)
+		} else {
+			s.lines[s.y].wrapped = true
+			s.x = 0
+			s.lineFeed()
+		}
+	}
+	s.wrapNext = false
+	if width > s.width {
+		return
+	}
+
+	cells := s.lines[s.y].cells
+	s.clearWide(s.y, s.x)
+	cells[s.x] = screenCell{char: string(r), style: s.pen.style()}
+	if width == 2 {
+		s.clearWide(s.y, s.x+1)
+		cells[s.x+1] = screenCell{style: s.pen.style(), continuation: true}
+	}
+
+	s.x += width
+	if s.x >= s.width {
+		s.x = s.width - 1
+		s.wrapNext = s.autowrap
+	}
+}
+
+// clearWide blanks the other half of a wide character about to be
+// partly overwritten at x.
+func (s *screen) clearWide(y, x int) {
+	cells := s.lines[y].cells
+	if cells[x].continuation && x > 0 {
+		cells[x-1] = screenCell{}
+	}
+	if x+1 < len(cells) && cells[x+1].continuation {
+		cells[x+1] = screenCell{}
+	}
+}
+
+func (s *screen) lineFeed() {
+	s.wrapNext = false
+	switch {
+	case s.y == s.bottom:
+		s.scrollUp(s.top, 1, true)
+	case s.y < s.height-1:
+		s.y++
+	}
+}
+
+func (s *screen) reverseIndex() {
+	s.wrapNext = false
+	switch {
+	case s.y == s.top:
+		s.scrollDown(s.top, 1)
+	case s.y > 0:
+		s.y--
+	}
+}
+
+// scrollUp moves the lines from top to the bottom of the scroll region up
+// by n. Like tmux, lines leaving the top of the main screen go to history.
+func (s *screen) scrollUp(top, n int, keep bool) {
+	n = min(n, s.bottom-top+1)
+	if keep && top == 0 && !s.alternate {
+		for _, line := range s.lines[:n] {
+			s.pushHistory(line)
+		}
+	}
+	copy(s.lines[top:s.bottom+1], s.lines[top+n:s.bottom+1])
+	for y := s.bottom - n + 1; y <= s.bottom; y++ {
+		s.lines[y] = s.blankLine()
+	}
+}
+
+func (s *screen) scrollDown(top, n int) {
+	n = min(n, s.bottom-top+1)
+	copy(s.lines[top+n:s.bottom+1], s.lines[top:s.bottom+1-n])
+	for y := top; y < top+n; y++ {
+		s.lines[y] = s.blankLine()
+	}
+}
+
+func (s *screen) pushHistory(line screenLine) {
+	if s.historyLimit <= 0 {
+		return
+	}
+
+	text := renderCells(line.cells, !line.wrapped)
+	if s.historyOpen && len(s.history) > 0 {
+		s.history[len(s.history)-1] += text
+	} else {
+		s.history = append(s.history, text)
+	}
+	s.historyOpen = line.wrapped
+
+	if len(s.history) > s.historyLimit {
+		s.history = s.history[len(s.history)-s.historyLimit:]
+	}
+}
+
+func (s *screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.erase(s.y, s.x, s.width)
+		for y := s.y + 1; y < s.height; y++ {
+			s.erase(y, 0, s.width)
+		}
+	case 1:
+		for y := 0; y < s.y; y++ {
+			s.erase(y, 0, s.width)
+		}
+		s.erase(s.y, 0, s.x+1)
+	case 2:
+		// NOTE: tmux scrolls a cleared main screen into history, up to its last used line
+		if !s.alternate {
+			used := 0
+			for y, line := range s.lines {
+				if renderCells(line.cells, true) != "" {
+					used = y + 1
+				}
+			}
+			for _, line := range s.lines[:used] {
+				s.pushHistory(line)
+			}
+		}
+		for y := range s.lines {
+			s.erase(y, 0, s.width)
+		}
+	case 3:
+		s.history, s.historyOpen = nil, false
+	}
+}
+
+func (s *screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.erase(s.y, s.x, s.width)
+	case 1:
+		s.erase(s.y, 0, s.x+1)
+	case 2:
+		s.erase(s.y, 0, s.width)
+	}
+}
+
+// erase blanks the cells from x to end on line y. Like tmux it keeps the
+// background colour and whether the line wraps.
+func (s *screen) erase(y, from, to int) {
+	blank := screenCell{style: s.pen.background()}
+	cells := s.lines[y].cells
+	for x := from; x < to && x < len(cells); x++ {
+		s.clearWide(y, x)
+		cells[x] = blank
+	}
+}
+
+func (s *screen) insertCells(n int) {
+	cells := s.lines[s.y].cells
+	n = min(n, s.width-s.x)
+	copy(cells[s.x+n:], cells[s.x:])
+	s.erase(s.y, s.x, s.x+n)
+}
+
+func (s *screen) deleteCells(n int) {
+	cells := s.lines[s.y].cells
+	n = min(n, s.width-s.x)
+	copy(cells[s.x:], cells[s.x+n:])
+	s.erase(s.y, s.width-n, s.width)
+}
+
+// Seed loads the screen from capture-pane output, history being the lines
+// above the visible ones, and moves the cursor to where tmux has it.
+func (s *screen) Seed(history, content []string, x, y int) {
+	s.history, s.historyOpen = nil, false
+	if s.historyLimit > 0 {
+		s.history = append(s.history, history[max(len(history)-s.historyLimit, 0):]...)
+	}
+
+	s.x, s.y = 0, 0
+	for i, line := range content {
+		if i > 0 {
+			s.Write("\r\n")
+		}
+		s.Write(line)
+	}
+
+	s.state, s.partial = stateGround, s.partial[:0]
+	s.pen, s.wrapNext = pen{}, false
+	s.x, s.y = min(max(x, 0), s.width-1), min(max(y, 0), s.height-1)
+}
+
+// Render returns the visible lines the way capture-pane -eJp prints them.
+func (s *screen) Render() string {
+	var b strings.Builder
+	var logical []screenCell
+	for _, line := range s.lines {
+		logical = append(logical, line.cells...)
+		if line.wrapped {
+			continue
+		}
+		b.WriteString(renderCells(logical, true))
+		b.WriteByte('\n')
+		logical = logical[:0]
+	}
+	if len(logical) > 0 {
+		b.WriteString(renderCells(logical, true))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// History returns up to the last n lines scrolled off the screen.
+func (s *screen) History(n int) string {
+	if n <= 0 || len(s.history) == 0 {
+		return ""
+	}
+	lines := s.history[max(len(s.history)-n, 0):]
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// renderCells writes cells with their SGR styles, trimming blank cells at
+// the end unless the line continues on the next one.
+func renderCells(cells []screenCell, trim bool) string {
+	end := len(cells)
+	if trim {
+		for end > 0 && cells[end-1].char == "" && cells[end-1].style == "" && !cells[end-1].continuation {
+			end--
+		}
+	}
+
+	var b strings.Builder
+	style := ""
+	for _, cell := range cells[:end] {
+		if cell.continuation {
+			continue
+		}
+		if cell.style != style {
+			b.WriteString(sgr(cell.style))
+			style = cell.style
+		}
+		if cell.char == "" {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteString(cell.char)
+	}
+	if style != "" {
+		b.WriteString(sgr(""))
+	}
+	return b.String()
+}
+
+func sgr(style string) string {
+	if style == "" {
+		return "\x1b[0m"
+	}
+	return "\x1b[0;" + style + "m"
+}
+
+// apply updates the pen from SGR parameters.
+func (p pen) apply(raw string) pen {
+	if raw == "" {
+		return pen{}
+	}
+
+	fields := strings.Split(raw, ";")
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		// NOTE: Colon forms like 38:2::1:2:3 carry the whole colour in one field
+		if strings.Contains(field, ":") {
+			switch {
+			case strings.HasPrefix(field, "38:"):
+				p.fg = field
+			case strings.HasPrefix(field, "48:"):
+				p.bg = field
+			case strings.HasPrefix(field, "4:"):
+				p.attrs |= 1 << 4
+				if field == "4:0" {
+					p.attrs &^= 1 << 4
+				}
+			}
+			continue
+		}
+
+		code, _ := strconv.Atoi(field)
+		switch {
+		case code == 0:
+			p = pen{}
+		case code >= 1 && code <= 9:
+			p.attrs |= 1 << code
+		case code == 21:
+			p.attrs |= 1 << 4
+		case code == 22:
+			p.attrs &^= 1<<1 | 1<<2
+		case code >= 23 && code <= 29:
+			p.attrs &^= 1 << (code - 20)
+		case code >= 30 && code <= 37, code >= 90 && code <= 97:
+			p.fg = field
+		case code == 39:
+			p.fg = ""
+		case code >= 40 && code <= 47, code >= 100 && code <= 107:
+			p.bg = field
+		case code == 49:
+			p.bg = ""
+		case code == 38 || code == 48:
+			colour, used := extendedColour(fields[i:])
+			if code == 38 {
+				p.fg = colour
+			} else {
+				p.bg = colour
+			}
+			i += used - 1
+		}
+	}
+	return p
+}
+
+// extendedColour reads a 38;5;n or 38;2;r;g;b colour, returning it and how
+// many fields it took.
+func extendedColour(fields []string) (string, int) {
+	if len(fields) >= 3 && fields[1] == "5" {
+		return strings.Join(fields[:3], ";"), 3
+	}
+	if len(fields) >= 5 && fields[1] == "2" {
+		return strings.Join(fields[:5], ";"), 5
+	}
+	return "", len(fields)
+}
+
+func (p pen) style() string {
+	var params []string
+	for code := 1; code <= 9; code++ {
+		if p.attrs&(1<<code) != 0 {
+			params = append(params, strconv.Itoa(code))
+		}
+	}
+	if p.fg != "" {
+		params = append(params, p.fg)
+	}
+	if p.bg != "" {
+		params = append(params, p.bg)
+	}
+	return strings.Join(params, ";")
+}
+
+// background is the style erased cells get.
+func (p pen) background() string {
+	return p.bg
+}
@@ -0,0 +1,157 @@
+package tmux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScreen(t *testing.T) {
+	tests := []struct {
+		name    string
+		width   int
+		height  int
+		history int
+		seed    []string
+		writes  []string
+		want    []string
+		scroll  []string
+	}{
+		{
+			name:   "plain text and newlines",
+			width:  10,
+			height: 3,
+			writes: []string{"one\r\ntwo"},
+			want:   []string{"one", "two", ""},
+		},
+		{
+			name:    "lines scrolled off go to history",
+			width:   10,
+			height:  2,
+			history: 10,
+			writes:  []string{"1\r\n2\r\n3\r\n4"},
+			want:    []string{"3", "4"},
+			scroll:  []string{"1", "2"},
+		},
+		{
+			name:    "history is bounded",
+			width:   10,
+			height:  1,
+			history: 2,
+			writes:  []string{"1\r\n2\r\n3\r\n4"},
+			want:    []string{"4"},
+			scroll:  []string{"2", "3"},
+		},
+		{
+			name:    "wrapped lines are joined",
+			width:   4,
+			height:  2,
+			history: 10,
+			writes:  []string{"abcdefgh\r\nx\r\ny"},
+			want:    []string{"x", "y"},
+			scroll:  []string{"abcdefgh"},
+		},
+		{
+			name:   "sequences split across writes",
+			width:  10,
+			height: 2,
+			writes: []string{"ab\x1b", "[2", "D", "X\xe2\x82", "\xac"},
+			want:   []string{"X€", ""},
+		},
+		{
+			name:   "cursor movement and erasing",
+			width:  10,
+			height: 3,
+			writes: []string{"aaaa\r\nbbbb\r\ncccc", "\x1b[2;3H\x1b[K", "\x1b[1;1H\x1b[2@", "\x1b[3;2H\x1b[2P"},
+			want:   []string{"  aaaa", "bb", "cc"},
+		},
+		{
+			name:   "insert and delete lines",
+			width:  10,
+			height: 3,
+			writes: []string{"a\r\nb\r\nc", "\x1b[2H\x1b[L", "\x1b[1H\x1b[M"},
+			want:   []string{"", "b", ""},
+		},
+		{
+			name:    "scroll region keeps the status line",
+			width:   10,
+			height:  3,
+			history: 10,
+			writes:  []string{"\x1b[3Hstatus\x1b[1;2r\x1b[1Ha\r\nb\r\nc"},
+			want:    []string{"b", "c", "status"},
+			scroll:  []string{"a"},
+		},
+		{
+			name:    "alternate screen leaves no history",
+			width:   10,
+			height:  2,
+			history: 10,
+			writes:  []string{"shell", "\x1b[?1049h\x1b[Hvim\r\n~\r\n~", "\x1b[?1049l"},
+			want:    []string{"shell", ""},
+		},
+		{
+			name:    "clearing the screen scrolls it into history",
+			width:   10,
+			height:  3,
+			history: 10,
+			writes:  []string{"a\r\nb", "\x1b[H\x1b[2J", "c"},
+			want:    []string{"c", "", ""},
+			scroll:  []string{"a", "b"},
+		},
+		{
+			name:   "colours are kept",
+			width:  10,
+			height: 1,
+			writes: []string{"\x1b[1;31mred\x1b[0m ok"},
+			want:   []string{"\x1b[0;1;31mred\x1b[0m ok"},
+		},
+		{
+			name:   "wide characters",
+			width:  4,
+			height: 2,
+			writes: []string{"日本語"},
+			want:   []string{"日本語"},
+		},
+		{
+			name:   "titles are ignored",
+			width:  10,
+			height: 1,
+			writes: []string{"\x1b]0;title\x07a\x1b]2;other\x1b\\b"},
+			want:   []string{"ab"},
+		},
+		{
+			name:    "seeded from capture-pane",
+			width:   10,
+			height:  3,
+			history: 10,
+			seed:    []string{"old", "$ ls", "file", ""},
+			writes:  []string{"$ "},
+			want:    []string{"$ ls", "file", "$ "},
+			scroll:  []string{"old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScreen(tt.width, tt.height, tt.history)
+			if tt.seed != nil {
+				s.Seed(tt.seed[:1], tt.seed[1:], 0, len(tt.seed)-2)
+			}
+			for _, data := range tt.writes {
+				s.Write(data)
+			}
+
+			want := strings.Join(tt.want, "\n") + "\n"
+			if got := s.Render(); got != want {
+				t.Errorf("Render() = %q, want %q", got, want)
+			}
+
+			wantScroll := ""
+			if len(tt.scroll) > 0 {
+				wantScroll = strings.Join(tt.scroll, "\n") + "\n"
+			}
+			if got := s.History(tt.history); got != wantScroll {
+				t.Errorf("History() = %q, want %q", got, wantScroll)
+			}
+		})
+	}
+}
@@ -1,22 +1,48 @@
 package tmux
 
+// Sessions, windows and panes on a socket other than the default one carry
+// it in Socket and have IDs qualified with it, see QualifyID.
 type Session struct {
-	ID   string
-	Name string
+	ID     string
+	Name   string
+	Socket string
 }
 
 type Window struct {
 	ID        string
+	Index     int
 	Name      string
 	SessionID string
+	Active    bool
+	Width     int
+	Height    int
+	Layout    string
+	Socket    string
 }
 
 type Pane struct {
-	ID        string
-	WindowID  string
-	SessionID string
-	Active    bool
-	Content   string
+	ID             string
+	Index          int
+	WindowID       string
+	SessionID      string
+	SessionName    string
+	WindowName     string
+	Active         bool
+	Content        string
+	CurrentCommand string
+	PID            int
+	CurrentPath    string
+	Title          string
+	Width          int
+	Height         int
+	Left           int
+	Top            int
+	Dead           bool
+	Socket         string
+	// Scrollback is the number of history lines to capture and Privacy
+	// what may be sent of the pane, from the rules that selected it.
+	Scrollback int
+	Privacy    string
 }
 
 type TmuxData struct {
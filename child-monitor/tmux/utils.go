@@ -4,11 +4,36 @@ import (
 	"bufio"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
-func GetSessions() ([]Session, error) {
-	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_id}:#{session_name}")
+// command runs tmux against the backend's socket.
+func (b ExecBackend) command(args ...string) *exec.Cmd {
+	switch socket := NormalizeSocket(b.Socket); {
+	case socket == "":
+	case strings.Contains(socket, "/"):
+		args = append([]string{"-S", socket}, args...)
+	default:
+		args = append([]string{"-L", socket}, args...)
+	}
+	return exec.Command("tmux", args...)
+}
+
+// target builds a session:window.pane target from qualified IDs.
+func target(ids ...string) string {
+	raw := make([]string, len(ids))
+	for i, id := range ids {
+		_, raw[i] = SplitID(id)
+	}
+	if len(raw) == 3 {
+		return fmt.Sprintf("%s:%s.%s", raw[0], raw[1], raw[2])
+	}
+	return strings.Join(raw, ":")
+}
+
+func (b ExecBackend) GetSessions() ([]Session, error) {
+	cmd := b.command("list-sessions", "-F", "#{session_id}:#{session_name}")
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
@@ -26,8 +51,9 @@ func GetSessions() ([]Session, error) {
 		parts := strings.SplitN(line, ":", 2)
 		if len(parts) == 2 {
 			sessions = append(sessions, Session{
-				ID:   parts[0],
-				Name: parts[1],
+				ID:     QualifyID(b.Socket, parts[0]),
+				Name:   parts[1],
+				Socket: NormalizeSocket(b.Socket),
 			})
 		}
 	}
@@ -35,8 +61,37 @@ func GetSessions() ([]Session, error) {
 	return sessions, nil
 }
 
-func GetWindows(sessionID string) ([]Window, error) {
-	cmd := exec.Command("tmux", "list-windows", "-t", sessionID, "-F", "#{window_id}:#{window_name}")
+// windowFormat lists window fields tab separated, name last.
+const windowFormat = "#{window_id}\t#{window_index}\t#{session_id}\t#{window_active}\t" +
+	"#{window_width}\t#{window_height}\t#{window_layout}\t#{window_name}"
+
+const windowFields = 8
+
+func parseWindow(line string) (Window, bool) {
+	parts := strings.SplitN(line, "\t", windowFields)
+	if len(parts) != windowFields {
+		return Window{}, false
+	}
+
+	index, _ := strconv.Atoi(parts[1])
+	width, _ := strconv.Atoi(parts[4])
+	height, _ := strconv.Atoi(parts[5])
+
+	return Window{
+		ID:        parts[0],
+		Index:     index,
+		SessionID: parts[2],
+		Active:    parts[3] == "1",
+		Width:     width,
+		Height:    height,
+		Layout:    parts[6],
+		Name:      parts[7],
+	}, true
+}
+
+func (b ExecBackend) listWindows(args ...string) ([]Window, error) {
+	args = append([]string{"list-windows"}, args...)
+	cmd := b.command(append(args, "-F", windowFormat)...)
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list windows: %w", err)
@@ -46,27 +101,70 @@ func GetWindows(sessionID string) ([]Window, error) {
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) == 2 {
-			windows = append(windows, Window{
-				ID:        parts[0],
-				Name:      parts[1],
-				SessionID: sessionID,
-			})
+		if window, ok := parseWindow(scanner.Text()); ok {
+			window.ID = QualifyID(b.Socket, window.ID)
+			window.SessionID = QualifyID(b.Socket, window.SessionID)
+			window.Socket = NormalizeSocket(b.Socket)
+			windows = append(windows, window)
 		}
 	}
 
 	return windows, nil
 }
 
-func GetPanes(sessionID, windowID string) ([]Pane, error) {
-	target := fmt.Sprintf("%s:%s", sessionID, windowID)
-	cmd := exec.Command("tmux", "list-panes", "-t", target, "-F", "#{pane_id}:#{pane_active}")
+func (b ExecBackend) GetWindows(sessionID string) ([]Window, error) {
+	return b.listWindows("-t", target(sessionID))
+}
+
+// GetAllWindows lists every window on the tmux server with its layout.
+func (b ExecBackend) GetAllWindows() ([]Window, error) {
+	return b.listWindows("-a")
+}
+
+// paneFormat lists pane fields tab separated. The title goes last since it
+// is free text set by programs and may contain anything.
+const paneFormat = "#{pane_id}\t#{pane_active}\t#{window_id}\t#{window_name}\t#{session_id}\t#{session_name}\t" +
+	"#{pane_current_command}\t#{pane_pid}\t#{pane_current_path}\t#{pane_width}\t#{pane_height}\t#{pane_dead}\t" +
+	"#{pane_left}\t#{pane_top}\t#{pane_index}\t#{pane_title}"
+
+const paneFields = 16
+
+func parsePane(line string) (Pane, bool) {
+	parts := strings.SplitN(line, "\t", paneFields)
+	if len(parts) != paneFields {
+		return Pane{}, false
+	}
+
+	pid, _ := strconv.Atoi(parts[7])
+	width, _ := strconv.Atoi(parts[9])
+	height, _ := strconv.Atoi(parts[10])
+	left, _ := strconv.Atoi(parts[12])
+	top, _ := strconv.Atoi(parts[13])
+	index, _ := strconv.Atoi(parts[14])
+
+	return Pane{
+		ID:             parts[0],
+		Active:         parts[1] == "1",
+		WindowID:       parts[2],
+		WindowName:     parts[3],
+		SessionID:      parts[4],
+		SessionName:    parts[5],
+		CurrentCommand: parts[6],
+		PID:            pid,
+		CurrentPath:    parts[8],
+		Width:          width,
+		Height:         height,
+		Dead:           parts[11] == "1",
+		Left:           left,
+		Top:            top,
+		Index:          index,
+		Title:          parts[15],
+	}, true
+}
+
+func (b ExecBackend) listPanes(args ...string) ([]Pane, error) {
+	args = append([]string{"list-panes"}, args...)
+	cmd := b.command(append(args, "-F", paneFormat)...)
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list panes: %w", err)
@@ -76,28 +174,30 @@ func GetPanes(sessionID, windowID string) ([]Pane, error) {
 	scanner := bufio.NewScanner(strings.NewReader(string(output)))
 
 	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) == 2 {
-			panes = append(panes, Pane{
-				ID:        parts[0],
-				WindowID:  windowID,
-				SessionID: sessionID,
-				Active:    parts[1] == "1",
-			})
+		if pane, ok := parsePane(scanner.Text()); ok {
+			pane.ID = QualifyID(b.Socket, pane.ID)
+			pane.WindowID = QualifyID(b.Socket, pane.WindowID)
+			pane.SessionID = QualifyID(b.Socket, pane.SessionID)
+			pane.Socket = NormalizeSocket(b.Socket)
+			panes = append(panes, pane)
 		}
 	}
 
 	return panes, nil
 }
 
-func GetPaneContent(sessionID, windowID, paneID string) (string, error) {
-	target := fmt.Sprintf("%s:%s.%s", sessionID, windowID, paneID)
-	cmd := exec.Command("tmux", "capture-pane", "-eJt", target, "-p")
+func (b ExecBackend) GetPanes(sessionID, windowID string) ([]Pane, error) {
+	return b.listPanes("-t", target(sessionID, windowID))
+}
+
+// GetAllPanes lists every pane on the tmux server in one call, used to
+// refresh pane metadata every sample.
+func (b ExecBackend) GetAllPanes() ([]Pane, error) {
+	return b.listPanes("-a")
+}
+
+func (b ExecBackend) GetPaneContent(sessionID, windowID, paneID string) (string, error) {
+	cmd := b.command("capture-pane", "-eJt", target(sessionID, windowID, paneID), "-p")
 	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to capture pane: %w", err)
@@ -106,8 +206,20 @@ func GetPaneContent(sessionID, windowID, paneID string) (string, error) {
 	return string(output), nil
 }
 
-func IsTmuxRunning() bool {
-	cmd := exec.Command("tmux", "list-sessions")
+// GetPaneScrollback captures up to lines of history above the visible
+// screen, oldest first.
+func (b ExecBackend) GetPaneScrollback(sessionID, windowID, paneID string, lines int) (string, error) {
+	cmd := b.command("capture-pane", "-eJt", target(sessionID, windowID, paneID), "-p", "-S", strconv.Itoa(-lines), "-E", "-1")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture pane scrollback: %w", err)
+	}
+
+	return string(output), nil
+}
+
+func (b ExecBackend) IsRunning() bool {
+	cmd := b.command("list-sessions")
 	err := cmd.Run()
 	return err == nil
 }
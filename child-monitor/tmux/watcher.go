@@ -0,0 +1,321 @@
+package tmux
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Update is what changed in the watched sessions since the previous one.
+// Layout is set when windows or panes were added, closed, resized or
+// rearranged and the selection rules should be re-resolved.
+type Update struct {
+	Panes  []string
+	Layout bool
+}
+
+// paneScreen is a watched pane's screen model. It's seeded once from
+// capture-pane and then fed every %output, while seeding output is kept in
+// pending so what tmux sent after the capture can be replayed onto it.
+type paneScreen struct {
+	screen  *screen
+	seeded  bool
+	seeding bool
+	pending []Notification
+	// alternate is set when seeded while the alternate screen was shown,
+	// the main screen behind it was never captured
+	alternate bool
+}
+
+// Watcher follows panes through control mode clients, one per session, and
+// keeps an in-memory screen per pane built from their output. Panes are only
+// captured to seed their screen and bursts of output are coalesced into one
+// Update.
+type Watcher struct {
+	coalesce time.Duration
+	updates  chan Update
+	signal   chan struct{}
+	done     chan struct{}
+
+	mutex   sync.Mutex
+	clients map[string]*ControlClient
+	screens map[string]*paneScreen
+	changed map[string]bool
+	layout  bool
+}
+
+func NewWatcher(coalesce time.Duration) *Watcher {
+	watcher := &Watcher{
+		coalesce: coalesce,
+		updates:  make(chan Update),
+		signal:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		clients:  make(map[string]*ControlClient),
+		screens:  make(map[string]*paneScreen),
+		changed:  make(map[string]bool),
+	}
+	go watcher.run()
+
+	return watcher
+}
+
+// Updates delivers coalesced changes, at most one per coalesce interval.
+func (w *Watcher) Updates() <-chan Update {
+	return w.updates
+}
+
+// Watch sets the panes to follow, attaching to their sessions and
+// detaching from sessions no longer needed.
+func (w *Watcher) Watch(panes []Pane) error {
+	sessions := make(map[string]string)
+	watched := make(map[string]Pane)
+	for _, pane := range panes {
+		sessions[pane.SessionID] = pane.Socket
+		watched[pane.ID] = pane
+	}
+
+	w.mutex.Lock()
+	var detach []*ControlClient
+	for sessionID, client := range w.clients {
+		select {
+		case <-client.Done():
+			delete(w.clients, sessionID)
+			continue
+		default:
+		}
+		if _, needed := sessions[sessionID]; !needed {
+			detach = append(detach, client)
+			delete(w.clients, sessionID)
+		}
+	}
+
+	var errs []error
+	for sessionID, socket := range sessions {
+		if _, attached := w.clients[sessionID]; attached {
+			continue
+		}
+		client, err := NewControlClient(ExecBackend{Socket: socket}, sessionID, w.handle)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		w.clients[sessionID] = client
+	}
+
+	for paneID := range w.screens {
+		if _, exists := watched[paneID]; !exists {
+			delete(w.screens, paneID)
+		}
+	}
+	for paneID, pane := range watched {
+		ps, exists := w.screens[paneID]
+		if !exists {
+			w.screens[paneID] = &paneScreen{}
+			continue
+		}
+		// NOTE: Resized panes are reflowed by tmux, seed them again rather than guessing how
+		if ps.seeded && (pane.Width > 0 && pane.Width != ps.screen.width || pane.Height > 0 && pane.Height != ps.screen.height || pane.Scrollback > ps.screen.historyLimit) {
+			ps.seeded = false
+		}
+	}
+	w.mutex.Unlock()
+
+	for _, client := range detach {
+		client.Close()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Capture returns the pane's visible content and scrollback from its screen
+// model, seeding it first if needed.
+func (w *Watcher) Capture(pane Pane) (string, string, error) {
+	w.mutex.Lock()
+	ps, exists := w.screens[pane.ID]
+	if !exists {
+		ps = &paneScreen{}
+		w.screens[pane.ID] = ps
+	}
+	if ps.seeded {
+		content, scrollback := ps.screen.Render(), ps.screen.History(pane.Scrollback)
+		w.mutex.Unlock()
+		return content, scrollback, nil
+	}
+	client := w.clients[pane.SessionID]
+	if client != nil {
+		ps.seeding, ps.pending = true, nil
+	}
+	w.mutex.Unlock()
+
+	// NOTE: Fall back to exec while a session has no control client yet
+	if client == nil {
+		backend := ExecBackend{Socket: pane.Socket}
+		content, err := backend.GetPaneContent(pane.SessionID, pane.WindowID, pane.ID)
+		if err != nil || pane.Scrollback <= 0 {
+			return content, "", err
+		}
+		scrollback, err := backend.GetPaneScrollback(pane.SessionID, pane.WindowID, pane.ID, pane.Scrollback)
+		return content, scrollback, err
+	}
+
+	seeded, alternate, seq, err := seedScreen(client, pane)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	pending := ps.pending
+	ps.seeding, ps.pending = false, nil
+	if err != nil {
+		return "", "", err
+	}
+	for _, notification := range pending {
+		if notification.Seq > seq {
+			seeded.Write(notification.Data)
+		}
+	}
+	ps.screen, ps.seeded, ps.alternate = seeded, true, alternate
+
+	return seeded.Render(), seeded.History(pane.Scrollback), nil
+}
+
+// seedScreen builds a pane's screen from capture-pane over the control
+// connection. It returns whether the alternate screen was shown and the Seq
+// output notified after the capture starts from.
+func seedScreen(client *ControlClient, pane Pane) (*screen, bool, uint64, error) {
+	_, paneID := SplitID(pane.ID)
+
+	// NOTE: Read before capturing, output in between moves the cursor at most by what's dropped with it
+	result := client.command("display-message", "-p", "-t", paneID, "#{pane_width} #{pane_height} #{cursor_x} #{cursor_y} #{alternate_on} #{history_size} #{scroll_region_upper} #{scroll_region_lower}")
+	if result.err != nil {
+		return nil, false, 0, fmt.Errorf("failed to read cursor of %s: %w", pane.ID, result.err)
+	}
+	var state []int
+	if len(result.lines) > 0 {
+		for _, field := range strings.Fields(result.lines[0]) {
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				break
+			}
+			state = append(state, value)
+		}
+	}
+	if len(state) < 6 {
+		return nil, false, 0, fmt.Errorf("failed to read cursor of %s: unexpected %q", pane.ID, result.lines)
+	}
+
+	// NOTE: With no history tmux clamps -S to the first visible line, so only capture what exists
+	var history []string
+	if lines := min(pane.Scrollback, state[5]); lines > 0 {
+		result = client.command("capture-pane", "-eJp", "-t", paneID, "-S", strconv.Itoa(-lines), "-E", "-1")
+		if result.err != nil {
+			return nil, false, 0, fmt.Errorf("failed to capture scrollback of %s: %w", pane.ID, result.err)
+		}
+		history = result.lines
+	}
+
+	result = client.command("capture-pane", "-eJp", "-t", paneID)
+	if result.err != nil {
+		return nil, false, 0, fmt.Errorf("failed to capture %s: %w", pane.ID, result.err)
+	}
+
+	s := newScreen(state[0], state[1], pane.Scrollback)
+	alternate := state[4] == 1
+	if alternate {
+		s.enterAlternate(false)
+	}
+	s.Seed(history, result.lines, state[2], state[3])
+	if len(state) >= 8 && state[6] < state[7] && state[7] < s.height {
+		s.top, s.bottom = state[6], state[7]
+	}
+
+	return s, alternate, result.seq, nil
+}
+
+func (w *Watcher) Close() error {
+	close(w.done)
+
+	w.mutex.Lock()
+	clients := w.clients
+	w.clients = make(map[string]*ControlClient)
+	w.mutex.Unlock()
+
+	for _, client := range clients {
+		client.Close()
+	}
+	return nil
+}
+
+func (w *Watcher) handle(notification Notification) {
+	w.mutex.Lock()
+	switch notification.Name {
+	case "output":
+		ps, watched := w.screens[notification.PaneID]
+		if !watched {
+			w.mutex.Unlock()
+			return
+		}
+		switch {
+		case ps.seeded:
+			ps.screen.Write(notification.Data)
+			// NOTE: Leaving an alternate screen seeded from capture-pane reveals a main screen never seen, so seed again
+			if ps.alternate && !ps.screen.Alternate() {
+				ps.seeded = false
+			}
+		case ps.seeding:
+			ps.pending = append(ps.pending, notification)
+		}
+		w.changed[notification.PaneID] = true
+	case "layout-change", "window-add", "window-close", "window-renamed", "window-pane-changed", "session-window-changed", "exit":
+		w.layout = true
+	default:
+		w.mutex.Unlock()
+		return
+	}
+	w.mutex.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run waits for the first change, lets more arrive for the coalesce
+// interval and then hands everything over as one Update.
+func (w *Watcher) run() {
+	for {
+		select {
+		case <-w.signal:
+		case <-w.done:
+			return
+		}
+
+		timer := time.NewTimer(w.coalesce)
+		select {
+		case <-timer.C:
+		case <-w.done:
+			timer.Stop()
+			return
+		}
+
+		w.mutex.Lock()
+		update := Update{Layout: w.layout}
+		for paneID := range w.changed {
+			update.Panes = append(update.Panes, paneID)
+		}
+		w.changed = make(map[string]bool)
+		w.layout = false
+		w.mutex.Unlock()
+
+		sort.Strings(update.Panes)
+
+		select {
+		case w.updates <- update:
+		case <-w.done:
+			return
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 )
 
 type PanePickerModel struct {
+	backend    tmux.Backend
 	windowName string
 	panes      []tmux.Pane
 	cursor     int
@@ -24,10 +25,11 @@ type PanePickerModel struct {
 	height     int
 }
 
-func NewPanePicker(windowName string, panes []tmux.Pane) PanePickerModel {
+func NewPanePicker(backend tmux.Backend, windowName string, panes []tmux.Pane) PanePickerModel {
 	clearPaneTerminal()
 
 	m := PanePickerModel{
+		backend:    backend,
 		windowName: windowName,
 		panes:      panes,
 		selected:   make(map[int]bool),
@@ -36,7 +38,7 @@ func NewPanePicker(windowName string, panes []tmux.Pane) PanePickerModel {
 	}
 
 	if len(panes) > 0 {
-		m.preview = getPanePreview(panes[0])
+		m.preview = getPanePreview(backend, panes[0])
 	}
 
 	return m
@@ -48,8 +50,8 @@ func clearPaneTerminal() {
 	cmd.Run()
 }
 
-func getPanePreview(pane tmux.Pane) string {
-	content, err := tmux.GetPaneContent(pane.SessionID, pane.WindowID, pane.ID)
+func getPanePreview(backend tmux.Backend, pane tmux.Pane) string {
+	content, err := backend.GetPaneContent(pane.SessionID, pane.WindowID, pane.ID)
 	if err != nil {
 		return fmt.Sprintf("Error loading pane: %v", err)
 	}
@@ -108,7 +110,7 @@ func (m PanePickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 		if oldCursor != m.cursor && m.cursor < len(m.panes) {
-			m.preview = getPanePreview(m.panes[m.cursor])
+			m.preview = getPanePreview(m.backend, m.panes[m.cursor])
 		}
 	}
 
@@ -32,9 +32,16 @@ type sessionItem struct {
 
 func (i sessionItem) FilterValue() string { return i.session.Name }
 func (i sessionItem) Title() string       { return i.session.Name }
-func (i sessionItem) Description() string { return fmt.Sprintf("Session ID: %s", i.session.ID) }
+func (i sessionItem) Description() string {
+	if i.session.Socket != "" {
+		_, id := tmux.SplitID(i.session.ID)
+		return fmt.Sprintf("Session ID: %s on socket %s", id, i.session.Socket)
+	}
+	return fmt.Sprintf("Session ID: %s", i.session.ID)
+}
 
 type SessionPickerModel struct {
+	backend  tmux.Backend
 	list     list.Model
 	sessions []tmux.Session
 	selected *tmux.Session
@@ -44,7 +51,7 @@ type SessionPickerModel struct {
 	height   int
 }
 
-func NewSessionPicker(sessions []tmux.Session) SessionPickerModel {
+func NewSessionPicker(backend tmux.Backend, sessions []tmux.Session) SessionPickerModel {
 	clearTerminal()
 
 	items := make([]list.Item, len(sessions))
@@ -59,6 +66,7 @@ func NewSessionPicker(sessions []tmux.Session) SessionPickerModel {
 	l.Styles.Title = titleStyle
 
 	m := SessionPickerModel{
+		backend:  backend,
 		list:     l,
 		sessions: sessions,
 		width:    80,
@@ -66,7 +74,7 @@ func NewSessionPicker(sessions []tmux.Session) SessionPickerModel {
 	}
 
 	if len(sessions) > 0 {
-		m.preview = getSessionPreview(sessions[0])
+		m.preview = getSessionPreview(backend, sessions[0])
 	}
 
 	return m
@@ -82,8 +90,8 @@ func clearTerminal() {
 	cmd.Run()
 }
 
-func getSessionPreview(session tmux.Session) string {
-	windows, err := tmux.GetWindows(session.ID)
+func getSessionPreview(backend tmux.Backend, session tmux.Session) string {
+	windows, err := backend.GetWindows(session.ID)
 	if err != nil {
 		return fmt.Sprintf("Error loading session: %v", err)
 	}
@@ -106,9 +114,9 @@ func getSessionPreview(session tmux.Session) string {
 
 	if len(windows) > 0 {
 		activeWindow := windows[0]
-		panes, err := tmux.GetPanes(session.ID, activeWindow.ID)
+		panes, err := backend.GetPanes(session.ID, activeWindow.ID)
 		if err == nil && len(panes) > 0 {
-			content, err := tmux.GetPaneContent(session.ID, activeWindow.ID, panes[0].ID)
+			content, err := backend.GetPaneContent(session.ID, activeWindow.ID, panes[0].ID)
 			if err == nil {
 				preview.WriteString(fmt.Sprintf("\nActive pane content:\n%s",
 					truncatePreview(content, 8)))
@@ -157,7 +165,7 @@ func (m SessionPickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	m.list, cmd = m.list.Update(msg)
 
 	if m.list.Index() != oldIndex && m.list.Index() < len(m.sessions) {
-		m.preview = getSessionPreview(m.sessions[m.list.Index()])
+		m.preview = getSessionPreview(m.backend, m.sessions[m.list.Index()])
 	}
 
 	return m, cmd
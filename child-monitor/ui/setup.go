@@ -12,6 +12,7 @@ type SetupModel struct {
 	step       int
 	serverName string
 	centralIP  string
+	authToken  string
 	inputs     []string
 	cursor     int
 	done       bool
@@ -21,7 +22,7 @@ type SetupModel struct {
 func NewSetupModel() SetupModel {
 	return SetupModel{
 		step:   0,
-		inputs: make([]string, 2),
+		inputs: make([]string, 3),
 	}
 }
 
@@ -38,23 +39,22 @@ func (m SetupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+c", "q":
+		case "ctrl+c", "esc":
 			m.quitting = true
 			return m, tea.Quit
 		case "enter":
-			if m.step < 1 {
-				m.inputs[m.step] = strings.TrimSpace(m.inputs[m.step])
+			m.inputs[m.step] = strings.TrimSpace(m.inputs[m.step])
+			if m.step < 2 {
 				if m.inputs[m.step] != "" {
 					m.step++
 				}
 			} else {
-				m.inputs[m.step] = strings.TrimSpace(m.inputs[m.step])
-				if m.inputs[m.step] != "" {
-					m.serverName = m.inputs[0]
-					m.centralIP = m.inputs[1]
-					m.done = true
-					return m, tea.Quit
-				}
+				// NOTE: The token may be left empty when the central has auth disabled
+				m.serverName = m.inputs[0]
+				m.centralIP = m.inputs[1]
+				m.authToken = m.inputs[2]
+				m.done = true
+				return m, tea.Quit
 			}
 		case "backspace":
 			if len(m.inputs[m.step]) > 0 {
@@ -86,17 +86,23 @@ func (m SetupModel) View() string {
 	questions := []string{
 		"Server name (e.g., web-server-01):",
 		"Central server address (IP:port or domain):",
+		"Agent token (leave empty if not required):",
 	}
 
 	for i, question := range questions {
+		answer := m.inputs[i]
+		if i == 2 {
+			answer = strings.Repeat("*", len(answer))
+		}
+
 		if i < m.step {
-			s.WriteString(fmt.Sprintf(" %s %s\n", question, m.inputs[i]))
+			s.WriteString(fmt.Sprintf(" %s %s\n", question, answer))
 		} else if i == m.step {
 			cursor := ""
 			if i == m.step {
 				cursor = "█"
 			}
-			s.WriteString(fmt.Sprintf(" %s %s%s\n", question, m.inputs[i], cursor))
+			s.WriteString(fmt.Sprintf(" %s %s%s\n", question, answer, cursor))
 		} else {
 			s.WriteString(fmt.Sprintf(" %s\n", question))
 		}
@@ -107,10 +113,15 @@ func (m SetupModel) View() string {
 			Faint(true).
 			Render("\nType your answer and press Enter to continue")
 		s.WriteString(footer)
+	} else if m.step == 1 {
+		footer := lipgloss.NewStyle().
+			Faint(true).
+			Render("\nExamples: 10.0.1.100:8080, 192.168.1.10, monitor.example.com, api.company.com:3000\nPress Enter to continue")
+		s.WriteString(footer)
 	} else {
 		footer := lipgloss.NewStyle().
 			Faint(true).
-			Render("\nExamples: 10.0.1.100:8080, 192.168.1.10, monitor.example.com, api.company.com:3000\nPress Enter to finish setup")
+			Render("\nThe token is issued by the central server admin\nPress Enter to finish setup")
 		s.WriteString(footer)
 	}
 
@@ -150,6 +161,10 @@ func (m SetupModel) GetConfig() (string, string, string, bool) {
 	return m.serverName, host, port, m.done
 }
 
+func (m SetupModel) AuthToken() string {
+	return m.authToken
+}
+
 func (m SetupModel) IsQuitting() bool {
 	return m.quitting
 }
@@ -13,6 +13,7 @@ import (
 )
 
 type WindowPickerModel struct {
+	backend     tmux.Backend
 	sessionName string
 	sessionID   string
 	windows     []tmux.Window
@@ -26,7 +27,7 @@ type WindowPickerModel struct {
 	height      int
 }
 
-func NewWindowPicker(sessionName string, windows []tmux.Window) WindowPickerModel {
+func NewWindowPicker(backend tmux.Backend, sessionName string, windows []tmux.Window) WindowPickerModel {
 	clearWindowTerminal()
 
 	sessionID := ""
@@ -35,6 +36,7 @@ func NewWindowPicker(sessionName string, windows []tmux.Window) WindowPickerMode
 	}
 
 	m := WindowPickerModel{
+		backend:     backend,
 		sessionName: sessionName,
 		sessionID:   sessionID,
 		windows:     windows,
@@ -44,7 +46,7 @@ func NewWindowPicker(sessionName string, windows []tmux.Window) WindowPickerMode
 	}
 
 	if len(windows) > 0 {
-		m.preview = getWindowPreview(windows[0])
+		m.preview = getWindowPreview(backend, windows[0])
 	}
 
 	return m
@@ -56,8 +58,8 @@ func clearWindowTerminal() {
 	cmd.Run()
 }
 
-func getWindowPreview(window tmux.Window) string {
-	panes, err := tmux.GetPanes(window.SessionID, window.ID)
+func getWindowPreview(backend tmux.Backend, window tmux.Window) string {
+	panes, err := backend.GetPanes(window.SessionID, window.ID)
 	if err != nil {
 		return fmt.Sprintf("Error loading window: %v", err)
 	}
@@ -73,7 +75,7 @@ func getWindowPreview(window tmux.Window) string {
 	activePaneContent := ""
 	for _, pane := range panes {
 		if pane.Active {
-			content, err := tmux.GetPaneContent(window.SessionID, window.ID, pane.ID)
+			content, err := backend.GetPaneContent(window.SessionID, window.ID, pane.ID)
 			if err == nil {
 				activePaneContent = content
 			}
@@ -82,7 +84,7 @@ func getWindowPreview(window tmux.Window) string {
 	}
 
 	if activePaneContent == "" && len(panes) > 0 {
-		content, err := tmux.GetPaneContent(window.SessionID, window.ID, panes[0].ID)
+		content, err := backend.GetPaneContent(window.SessionID, window.ID, panes[0].ID)
 		if err == nil {
 			activePaneContent = content
 		}
@@ -147,7 +149,7 @@ func (m WindowPickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		if oldCursor != m.cursor {
 			if m.cursor < len(m.windows) {
-				m.preview = getWindowPreview(m.windows[m.cursor])
+				m.preview = getWindowPreview(m.backend, m.windows[m.cursor])
 			} else {
 				m.preview = "Monitor all windows in session"
 			}